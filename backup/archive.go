@@ -0,0 +1,342 @@
+package backup
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cheggaaa/pb/v3"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/revlist"
+)
+
+const (
+	// manifestFile lists the sha256 checksum of every archive in a dated archive directory, in the format of sha256sum.
+	manifestFile = "SHA256SUMS"
+	bundleHeader = "# v2 git bundle\n"
+	bundleSuffix = ".bundle"
+	// archiveLayout names the dated directory of each archive run.
+	archiveLayout = "2006-01-02T15-04-05Z"
+	// packWindow is the window used for delta compression of the bundled objects, the same default git uses.
+	packWindow = 10
+)
+
+// Archive writes a self-contained git bundle of every repository in the backup root into a new dated directory below
+// out, together with a checksum manifest. It returns the dated directory. With incremental, each bundle only contains
+// the objects that are new since the previous archive run into out, repositories without changes are left out.
+func (c *GoGitBackup) Archive(ctx context.Context, out string, incremental bool) (string, error) {
+	if out == "" {
+		out = c.config.Archive
+	}
+	if out == "" {
+		return "", fmt.Errorf("no archive directory configured")
+	}
+
+	st, err := loadState(c.config.Repository)
+	if err != nil {
+		return "", err
+	}
+
+	target := path.Join(out, time.Now().UTC().Format(archiveLayout))
+	err = os.MkdirAll(target, 0755)
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s: %+v", target, err)
+	}
+
+	repos := c.local()
+	bar := pb.ProgressBarTemplate(progressTemplate).New(len(repos)).SetWriter(os.Stdout).Start()
+	defer bar.Finish()
+
+	checksums := make(map[string]string)
+	written := make(map[string]*bundleFile)
+	for _, name := range repos {
+		if ctx.Err() != nil {
+			break
+		}
+		bar.Increment()
+
+		// an increment is only restorable next to the bundles it builds on, another directory starts with a full one
+		var base map[string]string
+		if r, ok := st.Repositories[name]; ok && incremental && r.BundledIn == absolute(out) {
+			base = r.Bundled
+		}
+
+		// repositories outside of the backup root are archived below the path they have on disk
+		file := path.Clean("/" + name)[1:] + bundleSuffix
+		if c.encrypter != nil {
+			file += c.encrypter.suffix()
+		}
+		c._info(bar, fmt.Sprintf("Archiving %s", name))
+		b, err := bundle(path.Join(c.config.Repository, name), path.Join(target, file), base, c.encrypter)
+		if err == errUnchanged {
+			c._info(bar, fmt.Sprintf("Skipping %s, unchanged", name))
+			continue
+		} else if err != nil {
+			c._error(bar, fmt.Sprintf("Failed to archive %s - %+v", name, err))
+			continue
+		}
+		checksums[file] = b.sum
+		written[name] = b
+		st.bundled(name, absolute(out), b.tips)
+	}
+
+	err = writeManifest(path.Join(target, manifestFile), checksums)
+	if err != nil {
+		return target, err
+	}
+
+	if len(c.storages) > 0 && ctx.Err() == nil {
+		err = c.upload(ctx, st, target, written)
+		if err != nil {
+			c._error(bar, fmt.Sprintf("Failed to upload archives - %+v", err))
+		}
+	}
+
+	err = st.save()
+	if err != nil {
+		return target, err
+	}
+	return target, ctx.Err()
+}
+
+// local returns the location of every repository in the backup root and the roots of the accounts relative to the
+// backup root.
+func (c *GoGitBackup) local() []string {
+	repos := make([]string, 0)
+	for _, root := range c.roots() {
+		prefix, err := c.relative(root)
+		if err != nil {
+			log.Debugf("skipping %s, %+v", root, err)
+			continue
+		}
+		for _, name := range localRepos(root) {
+			repos = append(repos, path.Join(prefix, name))
+		}
+	}
+	return repos
+}
+
+// localRepos returns the location of every repository below root relative to root.
+func localRepos(root string) []string {
+	repos := make([]string, 0)
+	for _, location := range find(root, map[string]struct{}{}) {
+		name, err := filepath.Rel(root, location)
+		if err != nil || strings.HasPrefix(path.Base(name), stagingPrefix) {
+			continue
+		}
+		repos = append(repos, filepath.ToSlash(name))
+	}
+	sort.Strings(repos)
+	return repos
+}
+
+var errUnchanged = errors.New("no refs changed since the last bundle")
+
+// bundleFile is a bundle written by an archive run.
+type bundleFile struct {
+	file string
+	// sum is the checksum of the written file, content the checksum of the bundle before it was encrypted.
+	sum     string
+	content string
+	tips    map[string]string
+}
+
+// bundle writes a bundle of all refs of the repository at location to file. If base holds the tips of a previous
+// bundle, only objects that are new since then are bundled. If enc is set, the bundle is encrypted before it is
+// written.
+func bundle(location string, file string, base map[string]string, enc encrypter) (*bundleFile, error) {
+	r, err := git.PlainOpen(location)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open repo: %+v", err)
+	}
+
+	refs, err := bundleRefs(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(refs) == 0 {
+		return nil, fmt.Errorf("repository has no refs")
+	}
+
+	tips := make(map[string]string, len(refs))
+	for _, ref := range refs {
+		tips[ref.Name().String()] = ref.Hash().String()
+	}
+	if base != nil && reflect.DeepEqual(base, tips) {
+		return nil, errUnchanged
+	}
+
+	prerequisites, ignore := bundleBase(r, base)
+
+	err = os.MkdirAll(path.Dir(file), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.New()
+	var w io.WriteCloser = nopCloser{io.MultiWriter(f, hash)}
+	if enc != nil {
+		w, err = enc.encrypt(io.MultiWriter(f, hash))
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(file)
+			return nil, fmt.Errorf("failed to encrypt: %+v", err)
+		}
+	}
+
+	content := sha256.New()
+	err = writeBundle(io.MultiWriter(w, content), r, refs, prerequisites, ignore)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(file)
+		return nil, err
+	}
+	return &bundleFile{
+		file:    file,
+		sum:     hex.EncodeToString(hash.Sum(nil)),
+		content: hex.EncodeToString(content.Sum(nil)),
+		tips:    tips,
+	}, nil
+}
+
+// bundleBase returns the commits a bundle on top of the previously bundled tips requires, and the tips whose objects
+// can be left out. If any previous tip is gone from the repository, e.g., after a rewrite, the bundle falls back to a
+// full one.
+func bundleBase(r *git.Repository, base map[string]string) ([]plumbing.Hash, []plumbing.Hash) {
+	commits := make(map[plumbing.Hash]struct{})
+	ignore := make([]plumbing.Hash, 0, len(base))
+	for _, tip := range base {
+		h := plumbing.NewHash(tip)
+		o, err := r.Object(plumbing.AnyObject, h)
+		if err != nil {
+			log.Debugf("previous tip %s is gone, writing a full bundle", tip)
+			return nil, nil
+		}
+		if tag, ok := o.(*object.Tag); ok {
+			commit, err := tag.Commit()
+			if err != nil {
+				// tags that do not point to a commit can not be prerequisites
+				continue
+			}
+			o = commit
+		}
+		if commit, ok := o.(*object.Commit); ok {
+			commits[commit.Hash] = struct{}{}
+			ignore = append(ignore, h)
+		}
+	}
+
+	prerequisites := make([]plumbing.Hash, 0, len(commits))
+	for h := range commits {
+		prerequisites = append(prerequisites, h)
+	}
+	sort.Slice(prerequisites, func(i, j int) bool {
+		return prerequisites[i].String() < prerequisites[j].String()
+	})
+	return prerequisites, ignore
+}
+
+// writeBundle writes a v2 git bundle with the given refs to w. It contains every object reachable from the refs,
+// except for those that are reachable from ignore, which the prerequisites have to provide.
+func writeBundle(w io.Writer, r *git.Repository, refs []*plumbing.Reference, prerequisites []plumbing.Hash, ignore []plumbing.Hash) error {
+	buf := bufio.NewWriter(w)
+	_, _ = buf.WriteString(bundleHeader)
+	for _, h := range prerequisites {
+		_, _ = fmt.Fprintf(buf, "-%s\n", h)
+	}
+	tips := make([]plumbing.Hash, 0, len(refs))
+	for _, ref := range refs {
+		_, _ = fmt.Fprintf(buf, "%s %s\n", ref.Hash(), ref.Name())
+		tips = append(tips, ref.Hash())
+	}
+	_, _ = buf.WriteString("\n")
+
+	objects, err := revlist.Objects(r.Storer, tips, ignore)
+	if err != nil {
+		return fmt.Errorf("failed to collect objects: %+v", err)
+	}
+	// the order of revlist is random, sorting keeps the bundles of unchanged repositories identical
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].String() < objects[j].String()
+	})
+
+	_, err = packfile.NewEncoder(buf, r.Storer, false).Encode(objects, packWindow)
+	if err != nil {
+		return fmt.Errorf("failed to write pack: %+v", err)
+	}
+	return buf.Flush()
+}
+
+// bundleRefs returns HEAD followed by all refs of the repository, sorted by name.
+func bundleRefs(r *git.Repository) ([]*plumbing.Reference, error) {
+	iter, err := r.References()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list refs: %+v", err)
+	}
+
+	refs := make([]*plumbing.Reference, 0)
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference && !strings.HasPrefix(ref.Name().String(), internalRefs) {
+			refs = append(refs, ref)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		return refs[i].Name() < refs[j].Name()
+	})
+
+	if head, err := r.Head(); err == nil {
+		refs = append([]*plumbing.Reference{plumbing.NewHashReference(plumbing.HEAD, head.Hash())}, refs...)
+	}
+	return refs, nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// writeManifest writes the checksums in the format of sha256sum, so archives can be verified with `sha256sum -c`.
+func writeManifest(file string, checksums map[string]string) error {
+	names := make([]string, 0, len(checksums))
+	for name := range checksums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	for _, name := range names {
+		sb.WriteString(fmt.Sprintf("%s  %s\n", checksums[name], name))
+	}
+	return os.WriteFile(file, []byte(sb.String()), 0644)
+}
@@ -0,0 +1,273 @@
+package backup
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// commit writes a file into the worktree of the repository at location and commits it.
+func commit(t *testing.T, location string, content string) plumbing.Hash {
+	r, err := git.PlainOpen(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(path.Join(location, content), []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = w.Add(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := w.Commit(content, &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestGoGitBackup_ArchiveRestore(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	upstream := path.Join(dir, "upstream")
+	_, err := git.PlainInit(upstream, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit(t, upstream, "first")
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	identityFile := path.Join(dir, "identity.txt")
+	err = os.WriteFile(identityFile, []byte(identity.String()), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := path.Join(dir, "root")
+	err = clone(ctx, upstream, path.Join(root, "account/project"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	enc, err := newEncrypter(&Encryption{Recipients: []string{identity.Recipient().String()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &GoGitBackup{
+		config:    &Config{Repository: root, Archive: path.Join(dir, "archive")},
+		encrypter: enc,
+	}
+
+	full, err := c.Archive(ctx, "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path.Join(full, "account/project.bundle.age")); err != nil {
+		t.Fatal("expected an encrypted bundle", err)
+	}
+
+	// make sure the next run gets its own dated directory
+	time.Sleep(time.Second)
+	latest := commit(t, upstream, "second")
+	err = _pull(ctx, path.Join(root, "account/project"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	increment, err := c.Archive(ctx, "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o, err := archiveFile{path: path.Join(increment, "account/project.bundle.age")}.open(mustDecrypter(t, identityFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := readBundleHeader(o.Reader)
+	_ = o.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.prerequisites) != 1 {
+		t.Fatal("expected the increment to require the first commit, got", info.prerequisites)
+	}
+
+	restored := path.Join(dir, "restored")
+	err = c.Restore(ctx, "", restored, "", nil)
+	if err == nil {
+		t.Fatal("expected restoring encrypted archives without an identity to fail")
+	}
+
+	err = c.Restore(ctx, "", restored, identityFile, []string{"account"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := git.PlainOpen(path.Join(restored, "account/project"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, err := r.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.Hash() != latest {
+		t.Fatal("restored", head.Hash(), "expected", latest)
+	}
+	if _, err := os.Stat(path.Join(restored, "account/project/second")); err != nil {
+		t.Fatal("expected the worktree to be checked out", err)
+	}
+}
+
+func mustDecrypter(t *testing.T, identityFile string) *decrypter {
+	dec, err := newDecrypter(identityFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dec
+}
+
+func TestGoGitBackup_Restore_deletedRefs(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	upstream := path.Join(dir, "upstream")
+	u, err := git.PlainInit(upstream, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := commit(t, upstream, "first")
+	err = u.Storer.SetReference(plumbing.NewHashReference("refs/heads/feature", first))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = u.CreateTag("v1", first, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := path.Join(dir, "root")
+	location := path.Join(root, "account/project")
+	err = clone(ctx, upstream, location, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &GoGitBackup{config: &Config{Repository: root, Archive: path.Join(dir, "archive")}}
+	_, err = c.Archive(ctx, "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the branch and the tag are deleted after the full bundle
+	time.Sleep(time.Second)
+	r, err := git.PlainOpen(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []plumbing.ReferenceName{"refs/remotes/origin/feature", "refs/tags/v1"} {
+		if err := r.Storer.RemoveReference(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	commit(t, location, "second")
+	_, err = c.Archive(ctx, "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored := path.Join(dir, "restored")
+	err = c.Restore(ctx, "", restored, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr, err := git.PlainOpen(path.Join(restored, "account/project"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []plumbing.ReferenceName{"refs/remotes/origin/feature", "refs/tags/v1"} {
+		if _, err := rr.Reference(name, false); err == nil {
+			t.Fatal("expected", name, "to be gone after the restore")
+		}
+	}
+	if _, err := rr.Reference("refs/remotes/origin/master", false); err != nil {
+		t.Fatal("expected the remaining refs to be restored", err)
+	}
+}
+
+func TestGoGitBackup_Archive_newOutput(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	upstream := path.Join(dir, "upstream")
+	_, err := git.PlainInit(upstream, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit(t, upstream, "first")
+
+	root := path.Join(dir, "root")
+	location := path.Join(root, "account/project")
+	err = clone(ctx, upstream, location, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &GoGitBackup{config: &Config{Repository: root, Archive: path.Join(dir, "archive")}}
+	_, err = c.Archive(ctx, "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an incremental run into another directory has nothing to build on there
+	time.Sleep(time.Second)
+	latest := commit(t, location, "second")
+	other := path.Join(dir, "other")
+	target, err := c.Archive(ctx, other, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := archiveFile{path: path.Join(target, "account/project.bundle")}.open(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := readBundleHeader(o.Reader)
+	_ = o.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.prerequisites) != 0 {
+		t.Fatal("expected a full bundle in the new directory, got prerequisites", info.prerequisites)
+	}
+
+	restored := path.Join(dir, "restored")
+	err = c.Restore(ctx, other, restored, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := git.PlainOpen(path.Join(restored, "account/project"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, err := r.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.Hash() != latest {
+		t.Fatal("restored", head.Hash(), "expected", latest)
+	}
+}
@@ -4,15 +4,22 @@ import (
 	"context"
 	"fmt"
 	"github.com/go-git/go-git/v5/config"
+	"net/http"
 	"os"
 	"path"
+	"strings"
+	"text/template"
 	"time"
 
 	"github.com/cheggaaa/pb/v3"
 	"github.com/d5/tengo/v2"
+	"github.com/go-git/go-billy/v5/osfs"
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/storage/filesystem"
 	"github.com/gookit/color"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
 )
 
 var logger = logrus.New()
@@ -31,13 +38,14 @@ type Provider int
 const (
 	GitHub Provider = iota
 	GitLab
+	Gitea
 	//TODO: expand if you have more implementations ;)
 )
 
 type Orphaned int
 
 const (
-	IgnoreOrphaned = iota
+	IgnoreOrphaned Orphaned = iota
 	PullOrphaned
 	RemoveOrphaned
 )
@@ -49,21 +57,81 @@ type Account struct {
 	Args       []string `yaml:"args"`
 	BlackList  []string `yaml:"blacklist"`
 	FilterList []string `yaml:"filters"`
+
+	// TokenFile, TokenCommand and TokenSecret are alternatives to Token, the token is read from the file, is the first
+	// line printed by the shell command or is the named secret of the vault. Token itself can refer to environment
+	// variables, e.g., ${GITHUB_TOKEN}.
+	TokenFile    string `yaml:"token_file"`
+	TokenCommand string `yaml:"token_command"`
+	TokenSecret  string `yaml:"token_secret"`
+
+	// MaxBandwidth limits the traffic of this account, in addition to the global limit.
+	MaxBandwidth Bandwidth `yaml:"max_bandwidth"`
+	// Prefix is the path below which the archives of this account are uploaded, defaults to the name.
+	Prefix string `yaml:"prefix"`
+	// Quota limits the disk space the repositories of this account may take, repositories that would exceed it are
+	// not cloned.
+	Quota ByteSize `yaml:"quota"`
+	// DestinationOnly accounts are not backed up, they are only used as the target of a restore.
+	DestinationOnly bool `yaml:"destination_only"`
+	// Layout overrides the global layout for the repositories of this account.
+	Layout string `yaml:"layout"`
+
+	// Repository, OverwriteOnConflict and HandleOrphaned override the global settings of the same name for the
+	// repositories of this account. A relative repository is below the global one.
+	Repository          string    `yaml:"repository"`
+	OverwriteOnConflict *bool     `yaml:"overwrite_on_conflict"`
+	HandleOrphaned      *Orphaned `yaml:"handle_orphaned"`
 }
 
 type Config struct {
 	Repository string    `yaml:"repository"`
 	Accounts   []Account `yaml:"accounts"`
+	// Include are glob patterns of further config files, relative to the config, that are merged into it.
+	Include []string `yaml:"include"`
 
 	OverwriteOnConflict bool     `yaml:"overwrite_on_conflict"`
 	HandleOrphaned      Orphaned `yaml:"handle_orphaned"`
+
+	// Layout is a template for the location of each repository below the backup root with the fields .Account,
+	// .Provider, .Namespace, .Repo and .Name, defaults to {{.Namespace}}/{{.Repo}}.
+	Layout string `yaml:"layout"`
+
+	// Timeout bounds the clone or pull of a single repository, zero disables it.
+	Timeout time.Duration `yaml:"timeout"`
+	// StallTimeout aborts the clone or pull of a repository if no data was received for that long, zero disables it.
+	StallTimeout time.Duration `yaml:"stall_timeout"`
+	// MaxBandwidth limits the traffic of all accounts together, zero means unlimited.
+	MaxBandwidth Bandwidth `yaml:"max_bandwidth"`
+
+	// Archive is the directory the archive command writes its dated bundle directories to.
+	Archive string `yaml:"archive"`
+	// Encryption encrypts archives to the given recipients, archives are written in plain if it is not set.
+	Encryption *Encryption `yaml:"encryption"`
+	// Storage are the remote targets archives are uploaded to.
+	Storage *Storage `yaml:"storage"`
+	// Snapshots records a generation after each successful backup run.
+	Snapshots *Snapshots `yaml:"snapshots"`
+	// Networks share the objects of forks of the same project between their clones.
+	Networks []Network `yaml:"networks"`
+	// Vault holds the tokens that accounts refer to with token_secret.
+	Vault *Vault `yaml:"vault"`
+	// Mirrors are the accounts that the mirror command keeps in sync with another account.
+	Mirrors []Mirror `yaml:"mirrors"`
 }
 
 type GoGitBackup struct {
 	clients  []client
+	accounts map[string]client
+	layouts  map[string]*template.Template
 	config   *Config
 	repos    []Repository
 	errorLog *os.File
+
+	throttle  *rate.Limiter
+	throttles map[string]*rate.Limiter
+	encrypter encrypter
+	storages  []storage
 }
 
 type Visibility int
@@ -74,25 +142,62 @@ const (
 	Internal
 )
 
+func (v Visibility) String() string {
+	switch v {
+	case Public:
+		return "public"
+	case Internal:
+		return "internal"
+	default:
+		return "private"
+	}
+}
+
+// parseVisibility is the inverse of Visibility.String, anything unknown is treated as private.
+func parseVisibility(s string) Visibility {
+	switch s {
+	case "public":
+		return Public
+	case "internal":
+		return Internal
+	default:
+		return Private
+	}
+}
+
 type Repository struct {
-	CloneUrl     string
-	Name         string
-	Size         int64
-	CreatedAt    time.Time
-	Owner        bool
-	Member       bool
-	Visibility   Visibility
-	ProviderName string
-	Archived     bool
+	CloneUrl    string
+	Name        string
+	Path        string // the location of the backup relative to the backup root, set by the layout
+	Description string
+	Size        int64
+	// EstimatedSize is the size of the objects of the repository as reported by the provider, zero if unknown.
+	EstimatedSize ByteSize
+	CreatedAt     time.Time
+	Owner         bool
+	Member        bool
+	Visibility    Visibility
+	ProviderName  string
+	Archived      bool
 }
 
 type client interface {
-	Init() error
-	List() ([]Repository, error)
+	Init(ctx context.Context) error
+	List(ctx context.Context) ([]Repository, error)
 	Name() string
 	RegisterFilter(filters []*tengo.Script)
 }
 
+// destination is a client that repositories can be pushed to.
+type destination interface {
+	client
+	// ensure creates the repository name below namespace if it does not exist yet and returns the URL to push to. An
+	// empty namespace is the authenticated user.
+	ensure(ctx context.Context, namespace string, name string, visibility Visibility, description string) (string, error)
+}
+
+const progressTemplate = `{{ bar . "<" "-" (cycle . "↖" "↗" "↘" "↙" ) "." ">"}} {{speed . | white }} {{percent .}} {{string . "info" | green}}  {{string . "warn" | red}}`
+
 func (c *GoGitBackup) _info(bar *pb.ProgressBar, msg string) {
 	bar.Set("info", fmt.Sprintf("%50.50s", msg)).Set("warn", "")
 }
@@ -117,108 +222,288 @@ func NewGoBackup(cnf *Config, logFile *os.File) (*GoGitBackup, error) {
 		return nil, fmt.Errorf("%s is not a directory", cnf.Repository)
 	}
 
+	installGitTransport()
+
+	enc, err := newEncrypter(cnf.Encryption)
+	if err != nil {
+		return nil, err
+	}
+
+	backup := &GoGitBackup{
+		config:    cnf,
+		errorLog:  logFile,
+		throttle:  newLimiter(cnf.MaxBandwidth),
+		throttles: make(map[string]*rate.Limiter),
+		encrypter: enc,
+	}
+
+	backup.storages, err = backup.newStorages(cnf.Storage)
+	if err != nil {
+		return nil, err
+	}
+
 	clients := make([]client, 0)
+	backup.accounts = make(map[string]client)
+	backup.layouts = make(map[string]*template.Template)
 
 	for _, account := range cnf.Accounts {
-		filters := make([]*tengo.Script, 0)
-		for _, filterCode := range account.FilterList {
-			filters = append(filters, tengo.NewScript([]byte(filterCode)))
+		layout := account.Layout
+		if layout == "" {
+			layout = cnf.Layout
+		}
+		backup.layouts[account.Name], err = parseLayout(account.Name, layout)
+		if err != nil {
+			return nil, fmt.Errorf("account %s: %+v", account.Name, err)
 		}
 
-		switch account.Provider {
-
-		case GitHub:
-			client := &_githubClient{
-				ctx:   context.Background(),
-				Token: account.Token,
-				name:  account.Name,
-			}
-			if account.Args != nil && len(account.Args) > 0 {
-				client.User = account.Args[0]
-			}
-			client.RegisterFilter(filters)
-			clients = append(clients, client)
+		if l := newLimiter(account.MaxBandwidth); l != nil {
+			backup.throttles[account.Name] = l
+		}
 
-		case GitLab:
-			client := &_gitlabClient{
-				Token: account.Token,
-				name:  account.Name,
-			}
-			if account.Args != nil && len(account.Args) > 0 {
-				client.BaseURL = account.Args[0]
-			}
-			client.RegisterFilter(filters)
-			clients = append(clients, client)
-			//TODO: extend here if you add a new provider
+		accountClient := newClient(account, backup.httpClient(account.Name))
+		if accountClient == nil {
+			log.Debugf("skipping account %s, unknown provider %d", account.Name, account.Provider)
+			continue
+		}
+		backup.accounts[account.Name] = accountClient
+		if !account.DestinationOnly {
+			clients = append(clients, accountClient)
 		}
 	}
 
-	return &GoGitBackup{
-		config:   cnf,
-		clients:  clients,
-		errorLog: logFile,
-	}, nil
+	backup.clients = clients
+	return backup, nil
 }
 
-func (c *GoGitBackup) Do() {
-	if c.Check() != nil {
-		return
+// newClient creates the client of the provider of account, or nil if the provider is unknown.
+func newClient(account Account, http *http.Client) client {
+	filters := make([]*tengo.Script, 0)
+	for _, filterCode := range account.FilterList {
+		filters = append(filters, tengo.NewScript([]byte(filterCode)))
+	}
+
+	var arg string
+	if len(account.Args) > 0 {
+		arg = account.Args[0]
 	}
 
-	tmpl := `{{ bar . "<" "-" (cycle . "↖" "↗" "↘" "↙" ) "." ">"}} {{speed . | white }} {{percent .}} {{string . "info" | green}}  {{string . "warn" | red}}`
+	var accountClient client
+	switch account.Provider {
+	case GitHub:
+		accountClient = &_githubClient{Token: account.Token, User: arg, name: account.Name, http: http}
+	case GitLab:
+		accountClient = &_gitlabClient{Token: account.Token, BaseURL: arg, name: account.Name, http: http}
+	case Gitea:
+		accountClient = &_giteaClient{Token: account.Token, BaseURL: arg, name: account.Name, http: http}
+		//TODO: extend here if you add a new provider
+	default:
+		return nil
+	}
+	accountClient.RegisterFilter(filters)
+	return accountClient
+}
+
+// Do performs the backup of all repositories found by Check. If ctx is cancelled, the repository that is currently
+// processed is finished or rolled back and the remaining repositories are skipped. With resume, repositories that were
+// already completed by an interrupted previous run are skipped.
+func (c *GoGitBackup) Do(ctx context.Context, resume bool) error {
+	if err := c.Check(ctx); err != nil {
+		return err
+	}
+
+	st, err := loadState(c.config.Repository)
+	if err != nil {
+		return err
+	}
+	st.begin(resume)
+
+	err = c.migrate(st, c.repos)
+	if err != nil {
+		return fmt.Errorf("failed to migrate to the layout: %+v", err)
+	}
 
-	bar := pb.ProgressBarTemplate(tmpl).New(len(c.repos)).SetWriter(os.Stdout).Start()
+	bar := pb.ProgressBarTemplate(progressTemplate).New(len(c.repos)).SetWriter(os.Stdout).Start()
 
+	for _, root := range c.roots() {
+		cleanStaging(root)
+	}
+
+	space := c.budget(c.repos)
+	skipped := make([]string, 0)
 	updated := make(map[string]struct{}, 0)
 	for _, repo := range c.repos {
+		if ctx.Err() != nil {
+			break
+		}
 		bar.Increment()
 
-		targetLocation := path.Join(c.config.Repository, repo.Name)
-		updated[targetLocation] = struct{}{}
-		if _, err := os.Stat(targetLocation); err != nil {
-			//we assume that the file does not exist and proceed with pulling
-			c._info(bar, fmt.Sprintf("Cloning %s into %s", repo.Name, targetLocation))
-			_, err := git.PlainClone(targetLocation, false, &git.CloneOptions{
-				URL: repo.CloneUrl,
-			})
+		targetLocation := c.location(repo)
+		updated[absolute(targetLocation)] = struct{}{}
+		if resume && st.done(repo.Path) {
+			c._info(bar, fmt.Sprintf("Skipping %s, already completed", repo.Name))
+			continue
+		}
 
-			if err != nil {
-				c._error(bar, fmt.Sprintf("Failed to clone repo for %s - %+v", repo.Name, err))
+		err := c.fetch(ctx, bar, st, space, repo)
+		if _, ok := err.(*noSpaceError); ok {
+			skipped = append(skipped, fmt.Sprintf("%s: %+v", repo.Name, err))
+		}
+	}
+	bar.Finish()
+
+	if len(skipped) > 0 {
+		color.Style{color.FgBlack, color.BgGray}.Printf("Skipped %d repositories that would not fit:\n", len(skipped))
+		for _, s := range skipped {
+			fmt.Printf("  %s\n", s)
+		}
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	orphaned := make([]string, 0)
+	policies := make(map[string]Orphaned)
+	for _, orphan := range c.findOrphaned(updated) {
+		if policy := c.orphanPolicy(st, orphan); policy != IgnoreOrphaned {
+			orphaned = append(orphaned, orphan)
+			policies[orphan] = policy
+		}
+	}
+	if len(orphaned) > 0 {
+		bar = pb.ProgressBarTemplate(progressTemplate).New(len(orphaned)).SetWriter(os.Stdout).Start()
+		for _, orphan := range orphaned {
+			if ctx.Err() != nil {
+				break
 			}
-		} else {
-			c._info(bar, fmt.Sprintf("Pulling %s", targetLocation))
-			err := c.pull(repo)
-			if err != nil {
-				c._error(bar, fmt.Sprintf("Failed to clone pull for %s - %+v", repo.Name, err))
+			bar.Increment()
+			switch policies[orphan] {
+			case RemoveOrphaned:
+				err := os.RemoveAll(orphan)
+				c._info(bar, fmt.Sprintf("Removed orphaned repo %s - %v", orphan, err))
+			case PullOrphaned:
+				opCtx, watchdog, cancel := c.guard(ctx, "")
+				err := watchdog.explain(opCtx, _pull(opCtx, orphan))
+				cancel()
+				if err != nil && err != git.NoErrAlreadyUpToDate {
+					c._error(bar, fmt.Sprintf("Failed to pull orphaned repo %s - %v", orphan, err))
+				}
+				c._info(bar, fmt.Sprintf("Pulled orphaned repo %s", orphan))
 			}
 		}
+		bar.Finish()
+	}
 
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	st.finish()
+	err = st.save()
+	if err != nil {
+		return err
 	}
-	bar.Finish()
 
-	if c.config.HandleOrphaned != IgnoreOrphaned {
-		orphaned := c.findOrphaned(updated)
-		if len(orphaned) > 0 {
-			bar = pb.ProgressBarTemplate(tmpl).New(len(c.repos)).SetWriter(os.Stdout).Start()
-			for _, orphan := range orphaned {
-				if c.config.HandleOrphaned == RemoveOrphaned {
-					err := os.RemoveAll(orphan)
-					c._info(bar, fmt.Sprintf("Removed orphaned repo %s - %v", orphan, err))
-				} else if c.config.HandleOrphaned == PullOrphaned {
-					err := _pull(orphan)
-					if err != nil && err != git.NoErrAlreadyUpToDate {
-						c._error(bar, fmt.Sprintf("Failed to pull orphaned repo %s - %v", orphan, err))
-					}
-					c._info(bar, fmt.Sprintf("Pulled orphaned repo %s", orphan))
-				}
+	if c.config.Snapshots != nil && c.config.Snapshots.Enabled {
+		names := make([]string, 0, len(c.repos))
+		for _, repo := range c.repos {
+			names = append(names, repo.Path)
+		}
+		// a snapshot of a partial run would pin stale tips, and pruning could drop the last good ones
+		if incomplete := st.incomplete(names); len(incomplete) > 0 {
+			log.Warnf("Not recording a snapshot, %d repositories failed: %s", len(incomplete), strings.Join(incomplete, ", "))
+			return nil
+		}
+		s, err := c.snapshot(names)
+		if err != nil {
+			return fmt.Errorf("failed to record snapshot: %+v", err)
+		}
+		log.Infof("recorded snapshot %s", s.ID)
+		return c.PruneSnapshots()
+	}
+	return nil
+}
+
+// noSpaceError marks a repository that was not cloned because it would not fit on disk or into its quota.
+type noSpaceError struct {
+	error
+}
+
+// fetch clones repo into the backup root, or pulls it if it is already there, and records the outcome in st. If b is
+// set, repositories that would not fit into it are not cloned.
+func (c *GoGitBackup) fetch(ctx context.Context, bar *pb.ProgressBar, st *state, b *budget, repo Repository) error {
+	targetLocation := c.location(repo)
+
+	if _, err := os.Stat(targetLocation); err != nil && b != nil {
+		if err := b.reserve(repo, c.objectStore(repo.Name) != ""); err != nil {
+			c._error(bar, fmt.Sprintf("Skipping %s - %+v", repo.Name, err))
+			st.failed(repo.Path, repo.ProviderName, err)
+			if err := st.save(); err != nil {
+				c._error(bar, fmt.Sprintf("Failed to save state - %+v", err))
 			}
-			bar.Finish()
+			return &noSpaceError{err}
+		}
+	}
+
+	opCtx, watchdog, cancel := c.guard(ctx, repo.ProviderName)
+	store, err := c.share(opCtx, repo)
+	err = watchdog.explain(opCtx, err)
+	if err != nil {
+		c._error(bar, fmt.Sprintf("Failed to share objects of %s - %+v", repo.Name, err))
+	} else if _, err = os.Stat(targetLocation); err != nil {
+		//we assume that the file does not exist and proceed with pulling
+		c._info(bar, fmt.Sprintf("Cloning %s into %s", repo.Name, targetLocation))
+		err = watchdog.explain(opCtx, clone(opCtx, repo.CloneUrl, targetLocation, store))
+		if err != nil {
+			c._error(bar, fmt.Sprintf("Failed to clone repo for %s - %+v", repo.Name, err))
+		}
+	} else {
+		c._info(bar, fmt.Sprintf("Pulling %s", targetLocation))
+		err = watchdog.explain(opCtx, c.pull(opCtx, repo, store))
+		if err != nil {
+			c._error(bar, fmt.Sprintf("Failed to clone pull for %s - %+v", repo.Name, err))
+		}
+	}
+	cancel()
+
+	if err == nil {
+		refs, rerr := refTips(targetLocation)
+		if rerr != nil {
+			c._error(bar, fmt.Sprintf("Failed to read refs of %s - %+v", repo.Name, rerr))
 		}
+		st.succeeded(repo.Path, repo, refs)
+	} else {
+		st.failed(repo.Path, repo.ProviderName, err)
+	}
+	if err := st.save(); err != nil {
+		c._error(bar, fmt.Sprintf("Failed to save state - %+v", err))
 	}
+	return err
 }
 
+// findOrphaned returns the absolute location of every repository in the backup root and the roots of the accounts
+// that is not in known, the absolute locations of the listed repositories.
 func (c *GoGitBackup) findOrphaned(known map[string]struct{}) []string {
-	return find(c.config.Repository, known)
+	orphaned := make([]string, 0)
+	for _, root := range c.roots() {
+		orphaned = append(orphaned, find(root, known)...)
+	}
+	return orphaned
+}
+
+// orphanPolicy returns how the orphan at location is handled, according to the account that backed it up last or
+// whose root it is in.
+func (c *GoGitBackup) orphanPolicy(st *state, location string) Orphaned {
+	if key, err := c.relative(location); err == nil {
+		if r, ok := st.Repositories[key]; ok && r.Account != "" {
+			return c.settings(r.Account).handleOrphaned
+		}
+	}
+	for _, account := range c.config.Accounts {
+		if account.Repository != "" && below(absolute(location), absolute(accountRoot(c.config.Repository, account.Repository))) {
+			return c.settings(account.Name).handleOrphaned
+		}
+	}
+	return c.config.HandleOrphaned
 }
 
 // find all git directories that are not in the known map recursively starting from the given root path
@@ -226,7 +511,7 @@ func find(root string, known map[string]struct{}) []string {
 	orphaned := make([]string, 0)
 	entries, _ := os.ReadDir(root)
 	for _, e := range entries {
-		if e.IsDir() {
+		if e.IsDir() && e.Name() != objectStoreDir {
 			edir := path.Join(root, e.Name())
 			if _, err := os.Stat(path.Join(edir, ".git")); err != nil {
 				orphaned = append(orphaned, find(edir, known)...)
@@ -240,38 +525,133 @@ func find(root string, known map[string]struct{}) []string {
 	return orphaned
 }
 
-func (c *GoGitBackup) pull(repo Repository) error {
-	targetLocation := path.Join(c.config.Repository, repo.Name)
+// pull updates the clone of repo. If store is set, the clone borrows the objects of that shared repository.
+func (c *GoGitBackup) pull(ctx context.Context, repo Repository, store string) error {
+	targetLocation := c.location(repo)
+
+	if store != "" {
+		if err := borrow(targetLocation, store); err != nil {
+			return fmt.Errorf("failed to link object store: %+v", err)
+		}
+	}
 
-	err := _pull(targetLocation)
+	err := _pull(ctx, targetLocation)
 
 	if err == git.NoErrAlreadyUpToDate {
 		return nil
 	} else if err != nil {
-		if c.config.OverwriteOnConflict {
-			log.Infof("Deleting %s due to conflict", targetLocation)
+		if !c.settings(repo.ProviderName).overwriteOnConflict || ctx.Err() != nil {
+			return fmt.Errorf("failed to fetch repo:%+v", err)
+		}
+		log.Infof("Replacing %s due to conflict", targetLocation)
+		err = replace(ctx, repo.CloneUrl, targetLocation, store)
+		if err != nil {
+			return fmt.Errorf("failed to replace repo %s, keeping the original. %+v", repo.Name, err)
+		}
+		log.Infof("Overwritten %s", repo.Name)
+	}
+	return nil
+}
 
-			err = os.Rename(targetLocation, targetLocation+"_conflict")
-			if err != nil {
-				return fmt.Errorf("failed to delete %s due to conflict", targetLocation)
-			}
+// replace clones url into a staging directory and swaps it with the clone at targetLocation. The original is moved
+// aside under the staging prefix, so a run killed mid-swap leaves nothing behind that cleanStaging does not remove.
+func replace(ctx context.Context, url string, targetLocation string, store string) error {
+	staging, err := stage(ctx, url, targetLocation, store)
+	if err != nil {
+		return err
+	}
 
-			_, err := git.PlainClone(targetLocation, false, &git.CloneOptions{URL: repo.CloneUrl})
-			if err != nil {
-				log.Errorf("failed to clone repo %s, reverting. %+v", repo.Name, err)
-				err = os.Rename(targetLocation+"_conflict", targetLocation)
-				if err != nil {
-					return fmt.Errorf("failed to revert check %s_conflict for original", targetLocation)
-				}
-			}
-			log.Infof("Overwritten %s", repo.Name)
+	conflict := path.Join(path.Dir(targetLocation), stagingPrefix+path.Base(targetLocation)+"-conflict")
+	_ = os.RemoveAll(conflict)
+	err = os.Rename(targetLocation, conflict)
+	if err != nil {
+		_ = os.RemoveAll(staging)
+		return fmt.Errorf("failed to move %s aside: %+v", targetLocation, err)
+	}
+
+	err = os.Rename(staging, targetLocation)
+	if err != nil {
+		_ = os.RemoveAll(staging)
+		if rerr := os.Rename(conflict, targetLocation); rerr != nil {
+			return fmt.Errorf("failed to restore the original from %s: %+v", conflict, rerr)
 		}
-		return fmt.Errorf("failed to fetch repo:%+v", err)
+		return fmt.Errorf("failed to move clone into %s: %+v", targetLocation, err)
+	}
+	return os.RemoveAll(conflict)
+}
+
+// stagingPrefix marks the sibling directories that hold a clone while it is in flight.
+const stagingPrefix = ".gitback-staging-"
+
+// clone clones url into a staging directory next to targetLocation and only moves it into place once the clone
+// succeeded. An interrupted clone therefore never leaves a directory behind that looks like a valid repository. If
+// store is set, the clone borrows the objects of that shared repository instead of downloading them again.
+func clone(ctx context.Context, url string, targetLocation string, store string) error {
+	staging, err := stage(ctx, url, targetLocation, store)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(staging, targetLocation)
+	if err != nil {
+		_ = os.RemoveAll(staging)
+		return fmt.Errorf("failed to move clone into %s: %+v", targetLocation, err)
 	}
 	return nil
 }
 
-func _pull(targetLocation string) error {
+// stage clones url into a fresh staging directory next to targetLocation and returns its path.
+func stage(ctx context.Context, url string, targetLocation string, store string) (string, error) {
+	parent := path.Dir(targetLocation)
+	err := os.MkdirAll(parent, 0755)
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s: %+v", parent, err)
+	}
+
+	staging, err := os.MkdirTemp(parent, stagingPrefix+path.Base(targetLocation)+"-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create staging directory: %+v", err)
+	}
+
+	if store != "" {
+		err = borrow(staging, store)
+		if err != nil {
+			_ = os.RemoveAll(staging)
+			return "", fmt.Errorf("failed to link object store: %+v", err)
+		}
+	}
+
+	// the same as PlainCloneContext, but on top of the alternates written above
+	worktree := osfs.New(staging)
+	dot, err := worktree.Chroot(git.GitDirName)
+	if err == nil {
+		_, err = git.CloneContext(ctx, filesystem.NewStorage(dot, cache.NewObjectLRUDefault()), worktree, &git.CloneOptions{URL: url})
+	}
+	if err != nil {
+		_ = os.RemoveAll(staging)
+		return "", err
+	}
+	return staging, nil
+}
+
+// cleanStaging removes staging directories left behind by a previous run that was killed mid-clone.
+func cleanStaging(root string) {
+	entries, _ := os.ReadDir(root)
+	for _, e := range entries {
+		if !e.IsDir() || e.Name() == objectStoreDir {
+			continue
+		}
+		edir := path.Join(root, e.Name())
+		if strings.HasPrefix(e.Name(), stagingPrefix) {
+			log.Infof("Removing stale staging directory %s", edir)
+			_ = os.RemoveAll(edir)
+		} else if _, err := os.Stat(path.Join(edir, ".git")); err != nil {
+			cleanStaging(edir)
+		}
+	}
+}
+
+func _pull(ctx context.Context, targetLocation string) error {
 	r, err := git.PlainOpen(targetLocation)
 	if err != nil {
 		return fmt.Errorf("failed to open repo: %+v", err)
@@ -282,7 +662,7 @@ func _pull(targetLocation string) error {
 		return fmt.Errorf("failed to enter repo: %+v", err)
 	}
 
-	err = w.Pull(&git.PullOptions{
+	err = w.PullContext(ctx, &git.PullOptions{
 		Force: true,
 	})
 	return err
@@ -294,18 +674,18 @@ func (c *GoGitBackup) Close() {
 	}
 }
 
-func (c *GoGitBackup) Check() error {
+func (c *GoGitBackup) Check(ctx context.Context) error {
 	repos := make([]Repository, 0)
 
 	for _, client := range c.clients {
-		err := client.Init()
+		err := client.Init(ctx)
 		if err != nil {
 			color.Style{color.FgBlack, color.BgGray}.Printf("Failed to init client %s\n", client.Name())
 			color.Style{color.FgBlack, color.BgGray}.Printf("Reason:%+v", err)
 			return err
 		}
 
-		repo, err := client.List()
+		repo, err := c.list(ctx, client)
 		if err != nil {
 			color.Style{color.FgBlack, color.BgGray}.Printf("Failed to list repo for %s\n", client.Name())
 			color.Style{color.FgBlack, color.BgGray}.Printf("Reason:%+v", err)
@@ -329,13 +709,16 @@ func (c *GoGitBackup) Check() error {
 	return nil
 }
 
-func (c *GoGitBackup) Update() error {
-	err := c.Check()
+func (c *GoGitBackup) Update(ctx context.Context) error {
+	err := c.Check(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to check repo: %+v", err)
 	}
 	for _, repo := range c.repos {
-		targetLocation := path.Join(c.config.Repository, repo.Name)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		targetLocation := c.location(repo)
 
 		if _, err := os.Stat(targetLocation); err != nil {
 			continue
@@ -375,6 +758,59 @@ func (c *GoGitBackup) Update() error {
 	return nil
 }
 
+// list returns the repositories of the account of cl that are not on the blacklist of the account, located according
+// to the layout and below the root of the account.
+func (c *GoGitBackup) list(ctx context.Context, cl client) ([]Repository, error) {
+	repos, err := cl.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var account Account
+	for _, a := range c.config.Accounts {
+		if a.Name == cl.Name() {
+			account = a
+		}
+	}
+	layout, ok := c.layouts[cl.Name()]
+	if !ok {
+		layout, err = parseLayout(cl.Name(), c.config.Layout)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	root, err := c.relative(c.settings(account.Name).root)
+	if err != nil {
+		return nil, err
+	}
+
+	listed := make([]Repository, 0, len(repos))
+	for _, repo := range repos {
+		if blacklisted(repo.Name, account.BlackList) {
+			log.Debugf("%s was filtered due to the blacklist", repo.Name)
+			continue
+		}
+		location, err := locate(layout, account, repo)
+		if err != nil {
+			return nil, err
+		}
+		repo.Path = path.Join(root, location)
+		listed = append(listed, repo)
+	}
+	return listed, nil
+}
+
+// blacklisted reports whether name matches one of the patterns, in the syntax of path.Match.
+func blacklisted(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
 func filter(repo Repository, filters []*tengo.Script) bool {
 	for i, filter := range filters {
 		if !apply(filter, repo) {
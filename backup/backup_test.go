@@ -1,10 +1,17 @@
 package backup
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/d5/tengo/v2"
+	"github.com/go-git/go-git/v5"
 )
 
 func TestGoGitBackup_filter(t *testing.T) {
@@ -93,3 +100,182 @@ func TestGoGitBackup_filter(t *testing.T) {
 	}
 
 }
+
+func TestStage(t *testing.T) {
+	dir := t.TempDir()
+	upstream := path.Join(dir, "upstream")
+	if _, err := git.PlainInit(upstream, false); err != nil {
+		t.Fatal(err)
+	}
+	latest := commit(t, upstream, "first")
+
+	target := path.Join(dir, "root", "account", "project")
+	staging, err := stage(context.Background(), upstream, target, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path.Dir(staging) != path.Dir(target) || !strings.HasPrefix(path.Base(staging), stagingPrefix) {
+		t.Fatal("expected a staging directory next to", target, "got", staging)
+	}
+	r, err := git.PlainOpen(staging)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head, err := r.Head(); err != nil || head.Hash() != latest {
+		t.Fatal("expected the staging directory to hold the clone, got", head, err)
+	}
+
+	_, err = stage(context.Background(), path.Join(dir, "missing"), target, "")
+	if err == nil {
+		t.Fatal("expected cloning a missing repository to fail")
+	}
+	entries, _ := os.ReadDir(path.Dir(target))
+	if len(entries) != 1 {
+		t.Fatal("expected the failed clone to be removed, got", entries)
+	}
+}
+
+func TestGoGitBackup_pull_conflict(t *testing.T) {
+	tests := []struct {
+		desc      string
+		overwrite bool
+		fails     bool
+	}{
+		{"keeps the clone", false, true},
+		{"replaces the clone", true, false},
+	}
+
+	for _, test := range tests {
+		dir := t.TempDir()
+		ctx := context.Background()
+		upstream := path.Join(dir, "upstream")
+		if _, err := git.PlainInit(upstream, false); err != nil {
+			t.Fatal(err)
+		}
+		commit(t, upstream, "first")
+
+		root := path.Join(dir, "root")
+		repo := Repository{Name: "account/project", Path: "account/project", CloneUrl: upstream}
+		location := path.Join(root, repo.Path)
+		if err := clone(ctx, upstream, location, ""); err != nil {
+			t.Fatal(err)
+		}
+
+		// the histories diverge, so the pull can not fast-forward
+		local := commit(t, location, "local")
+		latest := commit(t, upstream, "second")
+
+		c := &GoGitBackup{config: &Config{Repository: root, OverwriteOnConflict: test.overwrite}}
+		err := c.pull(ctx, repo, "")
+		if (err != nil) != test.fails {
+			t.Fatal("failed", test.desc, "got", err)
+		}
+
+		r, err := git.PlainOpen(location)
+		if err != nil {
+			t.Fatal("failed", test.desc, err)
+		}
+		head, err := r.Head()
+		if err != nil {
+			t.Fatal("failed", test.desc, err)
+		}
+		expected := local
+		if test.overwrite {
+			expected = latest
+		}
+		if head.Hash() != expected {
+			t.Fatal("failed", test.desc, "got", head.Hash(), "expected", expected)
+		}
+
+		entries, _ := os.ReadDir(path.Dir(location))
+		if len(entries) != 1 || entries[0].Name() != "project" {
+			t.Fatal("failed", test.desc, "expected only the clone to be left, got", entries)
+		}
+	}
+}
+
+func TestCleanStaging(t *testing.T) {
+	root := t.TempDir()
+	dirs := []string{
+		stagingPrefix + "top",
+		"account/" + stagingPrefix + "project-1234",
+		"account/" + stagingPrefix + "project-conflict",
+		"account/project/.git",
+		"account/project/" + stagingPrefix + "tracked",
+		objectStoreDir + "/" + stagingPrefix + "store",
+	}
+	for _, dir := range dirs {
+		if err := os.MkdirAll(path.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cleanStaging(root)
+
+	tests := map[string]bool{
+		stagingPrefix + "top":                           false,
+		"account/" + stagingPrefix + "project-1234":     false,
+		"account/" + stagingPrefix + "project-conflict": false,
+		"account/project/.git":                          true,
+		"account/project/" + stagingPrefix + "tracked":  true,
+		objectStoreDir + "/" + stagingPrefix + "store":  true,
+	}
+	for dir, exists := range tests {
+		if _, err := os.Stat(path.Join(root, dir)); (err == nil) != exists {
+			t.Fatal("expected", dir, "to exist:", exists, "got", err)
+		}
+	}
+}
+
+func TestGoGitBackup_Do_cancel(t *testing.T) {
+	dir := t.TempDir()
+	upstream := path.Join(dir, "upstream")
+	if _, err := git.PlainInit(upstream, false); err != nil {
+		t.Fatal(err)
+	}
+	commit(t, upstream, "first")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// the second repository is cancelled while its clone is in flight
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cancel()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	root := path.Join(dir, "root")
+	c := &GoGitBackup{
+		config: &Config{Repository: root},
+		clients: []client{&fakeClient{
+			account: Account{Name: "github", Token: "valid"},
+			repos: []Repository{
+				{Name: "me/a", CloneUrl: upstream, ProviderName: "github"},
+				{Name: "me/b", CloneUrl: server.URL + "/me/b.git", ProviderName: "github"},
+				{Name: "me/c", CloneUrl: upstream, ProviderName: "github"},
+			},
+		}},
+	}
+	err := c.Do(ctx, false)
+	if err != context.Canceled {
+		t.Fatal("expected the run to be cancelled, got", err)
+	}
+
+	if _, err := git.PlainOpen(c.location(c.repos[0])); err != nil {
+		t.Fatal("expected the first repository to be cloned", err)
+	}
+	for _, repo := range c.repos[1:] {
+		if _, err := os.Stat(c.location(repo)); err == nil {
+			t.Fatal("expected", repo.Name, "not to be cloned")
+		}
+	}
+	entries, err := os.ReadDir(path.Dir(c.location(c.repos[1])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), stagingPrefix) {
+			t.Fatal("expected the cancelled clone to be removed, got", e.Name())
+		}
+	}
+}
@@ -0,0 +1,419 @@
+package backup
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var providerNames = map[Provider]string{
+	GitHub: "github",
+	GitLab: "gitlab",
+	Gitea:  "gitea",
+}
+
+var orphanedNames = map[Orphaned]string{
+	IgnoreOrphaned: "ignore",
+	PullOrphaned:   "pull",
+	RemoveOrphaned: "remove",
+}
+
+func (p Provider) String() string {
+	if name, ok := providerNames[p]; ok {
+		return name
+	}
+	return strconv.Itoa(int(p))
+}
+
+func (o Orphaned) String() string {
+	if name, ok := orphanedNames[o]; ok {
+		return name
+	}
+	return strconv.Itoa(int(o))
+}
+
+// ParseProvider parses the name of a provider, e.g., `github`, or its legacy number.
+func ParseProvider(raw string) (Provider, error) {
+	raw = strings.ToLower(strings.TrimSpace(raw))
+	for p, name := range providerNames {
+		if raw == name || raw == strconv.Itoa(int(p)) {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown provider %q, expected one of github, gitlab or gitea", raw)
+}
+
+// ParseOrphaned parses the name of an orphan policy, e.g., `remove`, or its legacy number.
+func ParseOrphaned(raw string) (Orphaned, error) {
+	raw = strings.ToLower(strings.TrimSpace(raw))
+	for o, name := range orphanedNames {
+		if raw == name || raw == strconv.Itoa(int(o)) {
+			return o, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown orphan policy %q, expected one of ignore, pull or remove", raw)
+}
+
+func (p *Provider) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var raw string
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+	provider, err := ParseProvider(raw)
+	if err != nil {
+		return err
+	}
+	*p = provider
+	return nil
+}
+
+func (p Provider) MarshalYAML() (interface{}, error) {
+	return p.String(), nil
+}
+
+func (o *Orphaned) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var raw string
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+	orphaned, err := ParseOrphaned(raw)
+	if err != nil {
+		return err
+	}
+	*o = orphaned
+	return nil
+}
+
+func (o Orphaned) MarshalYAML() (interface{}, error) {
+	return o.String(), nil
+}
+
+// UnmarshalYAML names the account in the errors of its fields, so that a typo can be found in long lists of accounts.
+func (a *Account) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var named struct {
+		Name string `yaml:"name"`
+	}
+	_ = unmarshal(&named)
+
+	// the alias has the fields of Account, but not this method
+	type account Account
+	err := unmarshal((*account)(a))
+	if err != nil {
+		return fmt.Errorf("account %q: %+v", named.Name, err)
+	}
+	return nil
+}
+
+// ConfigError is a problem with the config at a position of the YAML document.
+type ConfigError struct {
+	// File is the file of a config that is merged from several files, empty otherwise.
+	File   string
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e ConfigError) Error() string {
+	msg := e.Msg
+	if e.Line != 0 {
+		msg = fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Msg)
+	}
+	if e.File != "" {
+		msg = e.File + ": " + msg
+	}
+	return msg
+}
+
+// ConfigErrors are all problems found while validating a config.
+type ConfigErrors []ConfigError
+
+func (e ConfigErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// LoadConfig parses and validates a config and resolves the tokens of its accounts. Unknown fields, invalid values,
+// missing fields that a provider requires, invalid URLs, duplicate account names, unresolvable tokens and a missing
+// repository directory are all reported as ConfigErrors, with the position of each problem in the document.
+func LoadConfig(raw []byte) (*Config, error) {
+	root, err := document(raw)
+	if err != nil {
+		return nil, err
+	}
+	return (&validator{}).load(root)
+}
+
+// document parses raw into the node of its top-level mapping.
+func document(raw []byte) (*yaml.Node, error) {
+	var doc yaml.Node
+	err := yaml.Unmarshal(raw, &doc)
+	if err != nil {
+		return nil, err
+	}
+
+	root := &doc
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		root = root.Content[0]
+	}
+	return root, nil
+}
+
+// load validates and decodes the config at root.
+func (v *validator) load(root *yaml.Node) (*Config, error) {
+	v.fields(root, reflect.TypeOf(Config{}))
+	if len(v.errors) > 0 {
+		return nil, v.errors
+	}
+
+	config := &Config{}
+	err := root.Decode(config)
+	if err != nil {
+		return nil, err
+	}
+
+	v.secrets(root, config)
+	v.config(root, config)
+	if len(v.errors) > 0 {
+		return nil, v.errors
+	}
+	return config, nil
+}
+
+type validator struct {
+	errors ConfigErrors
+	// account names the account whose fields are checked, if any.
+	account string
+	// files maps the nodes of a config that is merged from several files to the file they are from.
+	files map[*yaml.Node]string
+}
+
+func (v *validator) errorf(n *yaml.Node, format string, args ...interface{}) {
+	e := ConfigError{Msg: fmt.Sprintf(format, args...), File: v.files[n]}
+	if v.account != "" {
+		e.Msg = fmt.Sprintf("account %q: %s", v.account, e.Msg)
+	}
+	if n != nil {
+		e.Line, e.Column = n.Line, n.Column
+	}
+	v.errors = append(v.errors, e)
+}
+
+var (
+	durationType    = reflect.TypeOf(time.Duration(0))
+	unmarshalerType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+	// obsoleteUnmarshalerType is the yaml.v2 style unmarshaler, which yaml.v3 still supports.
+	obsoleteUnmarshalerType = reflect.TypeOf((*interface {
+		UnmarshalYAML(unmarshal func(interface{}) error) error
+	})(nil)).Elem()
+)
+
+// fields reports every key of the mapping n that is not a field of t, and every value that can not be decoded into
+// the type of its field.
+func (v *validator) fields(n *yaml.Node, t reflect.Type) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	if n.Kind == yaml.ScalarNode && n.Tag == "!!null" {
+		return
+	}
+
+	// scalars with their own parser, e.g., sizes and provider names
+	custom := reflect.PointerTo(t).Implements(unmarshalerType) || reflect.PointerTo(t).Implements(obsoleteUnmarshalerType)
+	if t == durationType || (custom && t.Kind() != reflect.Struct) {
+		v.decode(n, t)
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if n.Kind != yaml.MappingNode {
+			v.errorf(n, "expected a mapping")
+			return
+		}
+		known := make(map[string]reflect.Type)
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+			if name == "-" || !f.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = strings.ToLower(f.Name)
+			}
+			known[name] = f.Type
+		}
+		if t == reflect.TypeOf(Account{}) {
+			v.account = node(n, "name").Value
+			defer func() { v.account = "" }()
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			ft, ok := known[key.Value]
+			if !ok {
+				v.errorf(key, "unknown field %q in %s", key.Value, t.Name())
+				continue
+			}
+			v.fields(value, ft)
+		}
+	case reflect.Slice:
+		if n.Kind != yaml.SequenceNode {
+			v.errorf(n, "expected a list")
+			return
+		}
+		for _, item := range n.Content {
+			v.fields(item, t.Elem())
+		}
+	case reflect.Map:
+		if n.Kind != yaml.MappingNode {
+			v.errorf(n, "expected a mapping")
+			return
+		}
+		for i := 1; i < len(n.Content); i += 2 {
+			v.fields(n.Content[i], t.Elem())
+		}
+	default:
+		v.decode(n, t)
+	}
+}
+
+// decode reports an error at n if its value can not be decoded into t.
+func (v *validator) decode(n *yaml.Node, t reflect.Type) {
+	err := n.Decode(reflect.New(t).Interface())
+	if err == nil {
+		return
+	}
+
+	msg := err.Error()
+	if e, ok := err.(*yaml.TypeError); ok && len(e.Errors) > 0 {
+		// the position is reported separately
+		msg = e.Errors[0]
+		if _, rest, ok := strings.Cut(msg, ": "); ok && strings.HasPrefix(msg, "line ") {
+			msg = rest
+		}
+	}
+	v.errorf(n, "%s", msg)
+}
+
+// node returns the node at the path of mapping keys and sequence indices below n. If the path does not exist, the
+// deepest node on the path is returned, so that errors about missing fields point at their parent.
+func node(n *yaml.Node, path ...interface{}) *yaml.Node {
+	for _, p := range path {
+		var next *yaml.Node
+		switch p := p.(type) {
+		case string:
+			for i := 0; n.Kind == yaml.MappingNode && i+1 < len(n.Content); i += 2 {
+				if n.Content[i].Value == p {
+					next = n.Content[i+1]
+				}
+			}
+		case int:
+			if n.Kind == yaml.SequenceNode && p < len(n.Content) {
+				next = n.Content[p]
+			}
+		}
+		if next == nil {
+			return n
+		}
+		n = next
+	}
+	return n
+}
+
+// config checks the decoded config for problems that are not about the syntax of single values.
+func (v *validator) config(root *yaml.Node, config *Config) {
+	if config.Repository == "" {
+		v.errorf(root, "repository is required")
+	} else if info, err := os.Stat(config.Repository); err != nil {
+		v.errorf(node(root, "repository"), "repository %s does not exist", config.Repository)
+	} else if !info.IsDir() {
+		v.errorf(node(root, "repository"), "repository %s is not a directory", config.Repository)
+	}
+
+	if _, err := parseLayout("layout", config.Layout); err != nil {
+		v.errorf(node(root, "layout"), "%+v", err)
+	}
+
+	names := make(map[string]struct{})
+	for i, account := range config.Accounts {
+		n := node(root, "accounts", i)
+		if account.Name == "" {
+			v.errorf(n, "account name is required")
+		} else if _, ok := names[account.Name]; ok {
+			v.errorf(node(n, "name"), "duplicate account name %q", account.Name)
+		}
+		names[account.Name] = struct{}{}
+
+		if account.Token == "" && account.TokenFile == "" && account.TokenCommand == "" && account.TokenSecret == "" {
+			v.errorf(n, "account %q: one of token, token_file, token_command or token_secret is required", account.Name)
+		}
+
+		var arg string
+		if len(account.Args) > 0 {
+			arg = account.Args[0]
+		}
+		// github accounts without the user name of the token still back up public repositories, as they always did
+		switch account.Provider {
+		case GitLab:
+			if arg != "" {
+				v.url(node(n, "args", 0), account.Name, arg)
+			}
+		case Gitea:
+			if arg == "" {
+				v.errorf(node(n, "args"), "account %q: gitea requires the URL of the instance as first argument", account.Name)
+			} else {
+				v.url(node(n, "args", 0), account.Name, arg)
+			}
+		}
+
+		if account.Layout != "" {
+			if _, err := parseLayout(account.Name, account.Layout); err != nil {
+				v.errorf(node(n, "layout"), "account %q: %+v", account.Name, err)
+			}
+		}
+
+		// relative roots are below the global one and created with the first clone
+		if account.Repository != "" {
+			dir := accountRoot(config.Repository, account.Repository)
+			if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+				v.errorf(node(n, "repository"), "account %q: repository %s is not a directory", account.Name, dir)
+			} else if err != nil && path.IsAbs(account.Repository) {
+				v.errorf(node(n, "repository"), "account %q: repository %s does not exist", account.Name, dir)
+			}
+		}
+
+		for j, pattern := range account.BlackList {
+			if _, err := path.Match(pattern, ""); err != nil {
+				v.errorf(node(n, "blacklist", j), "account %q: invalid blacklist pattern %q", account.Name, pattern)
+			}
+		}
+	}
+
+	for i, mirror := range config.Mirrors {
+		n := node(root, "mirrors", i)
+		for _, field := range []struct{ key, account string }{{"source", mirror.Source}, {"destination", mirror.Destination}} {
+			if _, ok := names[field.account]; !ok {
+				v.errorf(node(n, field.key), "mirror %s %q is not a configured account", field.key, field.account)
+			}
+		}
+	}
+}
+
+func (v *validator) url(n *yaml.Node, account string, raw string) {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.errorf(n, "account %q: %q is not a valid http(s) URL", account, raw)
+	}
+}
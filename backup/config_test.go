@@ -0,0 +1,219 @@
+package backup
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfig_namedValues(t *testing.T) {
+	root := t.TempDir()
+
+	tests := []struct {
+		desc     string
+		in       string
+		provider Provider
+		orphaned Orphaned
+		err      string
+	}{
+		{
+			desc: "names",
+			in: `repository: ROOT
+handle_orphaned: remove
+accounts:
+  - name: work
+    provider: GitLab
+    token: secret
+`,
+			provider: GitLab,
+			orphaned: RemoveOrphaned,
+		},
+		{
+			desc: "legacy integers",
+			in: `repository: ROOT
+handle_orphaned: 1
+accounts:
+  - name: work
+    provider: 2
+    token: secret
+    args: [https://gitea.example.com]
+`,
+			provider: Gitea,
+			orphaned: PullOrphaned,
+		},
+		{
+			desc: "unknown provider names the account",
+			in: `repository: ROOT
+accounts:
+  - name: work
+    provider: bitbucket
+    token: secret
+`,
+			err: `account "work": unknown provider "bitbucket"`,
+		},
+		{
+			desc: "unknown legacy provider",
+			in: `repository: ROOT
+accounts:
+  - name: work
+    provider: 7
+    token: secret
+`,
+			err: `account "work": unknown provider "7"`,
+		},
+		{
+			desc: "unknown orphan policy",
+			in: `repository: ROOT
+handle_orphaned: archive
+`,
+			err: `unknown orphan policy "archive"`,
+		},
+	}
+
+	for _, test := range tests {
+		config, err := LoadConfig([]byte(strings.ReplaceAll(test.in, "ROOT", root)))
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatal("failed", test.desc, "got", err, "expected", test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal("failed", test.desc, err)
+		}
+		if config.Accounts[0].Provider != test.provider || config.HandleOrphaned != test.orphaned {
+			t.Fatal("failed", test.desc, "got", config.Accounts[0].Provider, config.HandleOrphaned)
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	root := t.TempDir()
+
+	tests := []struct {
+		desc     string
+		in       string
+		expected []string
+	}{
+		{
+			desc: "valid",
+			in: `repository: ROOT
+timeout: 2h
+max_bandwidth: 5MiB/s
+accounts:
+  - name: work
+    provider: gitlab
+    token: secret
+    args: [https://gitlab.example.com]
+  - name: home
+    provider: gitea
+    token: secret
+    args: [https://gitea.example.com]
+mirrors:
+  - source: work
+    destination: home
+`,
+		},
+		{
+			desc: "unknown fields",
+			in: `repository: ROOT
+accounts:
+  - name: work
+    provider: github
+    token: secret
+    args: [me]
+    blacklist: [me/secret-*]
+    filter:
+      - "r := owner"
+`,
+			expected: []string{`line 8, column 5: account "work": unknown field "filter" in Account`},
+		},
+		{
+			desc: "invalid values",
+			in: `repository: ROOT
+timeout: soon
+accounts:
+  - name: work
+    provider: bitbucket
+    token: secret
+`,
+			expected: []string{
+				"line 2, column 10: cannot unmarshal !!str `soon` into time.Duration",
+				`line 5, column 15: account "work": unknown provider "bitbucket", expected one of github, gitlab or gitea`,
+			},
+		},
+		{
+			desc: "semantic problems",
+			in: `repository: /does/not/exist
+accounts:
+  - name: work
+    provider: github
+    token: secret
+  - name: work
+    provider: gitea
+    args: [gitea.example.com]
+    blacklist: ["[oops"]
+mirrors:
+  - source: work
+    destination: elsewhere
+`,
+			expected: []string{
+				"line 1, column 13: repository /does/not/exist does not exist",
+				`line 6, column 11: duplicate account name "work"`,
+				`line 6, column 5: account "work": one of token, token_file, token_command or token_secret is required`,
+				`line 8, column 12: account "work": "gitea.example.com" is not a valid http(s) URL`,
+				`line 9, column 17: account "work": invalid blacklist pattern "[oops"`,
+				`line 12, column 18: mirror destination "elsewhere" is not a configured account`,
+			},
+		},
+		{
+			desc: "invalid layouts",
+			in: `repository: ROOT
+layout: "{{.Owner}}/{{.Repo}}"
+accounts:
+  - name: work
+    provider: github
+    token: secret
+    args: [me]
+    layout: "{{.Account"
+`,
+			expected: []string{
+				`line 2, column 9: invalid layout "{{.Owner}}/{{.Repo}}": template: layout:1:2: executing "layout" at <.Owner>: can't evaluate field Owner in type backup.layoutFields`,
+				`line 8, column 13: account "work": invalid layout "{{.Account": template: work:1: unclosed action`,
+			},
+		},
+		{
+			desc: "account overrides",
+			in: `repository: ROOT
+accounts:
+  - name: work
+    provider: github
+    token: secret
+    args: [me]
+    repository: /does/not/exist
+    handle_orphaned: ignore
+`,
+			expected: []string{`line 7, column 17: account "work": repository /does/not/exist does not exist`},
+		},
+	}
+
+	for _, test := range tests {
+		config, err := LoadConfig([]byte(strings.ReplaceAll(test.in, "ROOT", root)))
+		if len(test.expected) == 0 {
+			if err != nil {
+				t.Fatal("failed", test.desc, err)
+			}
+			if config.Accounts[1].Provider != Gitea || config.MaxBandwidth != 5<<20 {
+				t.Fatal("failed", test.desc, "got", config)
+			}
+			continue
+		}
+
+		errs, ok := err.(ConfigErrors)
+		if !ok {
+			t.Fatal("failed", test.desc, "expected config errors, got", err)
+		}
+		if errs.Error() != strings.Join(test.expected, "\n") {
+			t.Fatalf("failed %s, got\n%s\nexpected\n%s", test.desc, errs, strings.Join(test.expected, "\n"))
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+// passphraseEnv holds the passphrase of an encrypted OpenPGP private key used to decrypt archives.
+const passphraseEnv = "GITBACK_PASSPHRASE"
+
+const ageHeader = "age-encryption.org/"
+
+// Encryption configures the recipients that archives are encrypted to.
+type Encryption struct {
+	// Recipients are age X25519 public keys (age1...) or files with an armored OpenPGP public key. All recipients
+	// have to use the same kind of key.
+	Recipients []string `yaml:"recipients"`
+}
+
+// encrypter encrypts archives before they are written.
+type encrypter interface {
+	encrypt(w io.Writer) (io.WriteCloser, error)
+	// suffix is appended to the name of each encrypted archive.
+	suffix() string
+}
+
+type ageEncrypter struct {
+	recipients []age.Recipient
+}
+
+func (e *ageEncrypter) encrypt(w io.Writer) (io.WriteCloser, error) {
+	return age.Encrypt(w, e.recipients...)
+}
+
+func (e *ageEncrypter) suffix() string {
+	return ".age"
+}
+
+type pgpEncrypter struct {
+	recipients openpgp.EntityList
+}
+
+func (e *pgpEncrypter) encrypt(w io.Writer) (io.WriteCloser, error) {
+	return openpgp.Encrypt(w, e.recipients, nil, &openpgp.FileHints{IsBinary: true}, nil)
+}
+
+func (e *pgpEncrypter) suffix() string {
+	return ".gpg"
+}
+
+// newEncrypter returns the encrypter for the configured recipients, or nil if encryption is not configured.
+func newEncrypter(cnf *Encryption) (encrypter, error) {
+	if cnf == nil || len(cnf.Recipients) == 0 {
+		return nil, nil
+	}
+
+	ageRecipients := make([]age.Recipient, 0)
+	pgpRecipients := make(openpgp.EntityList, 0)
+	for _, recipient := range cnf.Recipients {
+		if strings.HasPrefix(recipient, "age1") {
+			r, err := age.ParseX25519Recipient(recipient)
+			if err != nil {
+				return nil, fmt.Errorf("invalid age recipient %s: %+v", recipient, err)
+			}
+			ageRecipients = append(ageRecipients, r)
+			continue
+		}
+
+		f, err := os.Open(recipient)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read OpenPGP key %s: %+v", recipient, err)
+		}
+		entities, err := openpgp.ReadArmoredKeyRing(f)
+		_ = f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid OpenPGP key %s: %+v", recipient, err)
+		}
+		pgpRecipients = append(pgpRecipients, entities...)
+	}
+
+	switch {
+	case len(ageRecipients) > 0 && len(pgpRecipients) > 0:
+		return nil, fmt.Errorf("age and OpenPGP recipients can not be mixed")
+	case len(ageRecipients) > 0:
+		return &ageEncrypter{recipients: ageRecipients}, nil
+	default:
+		return &pgpEncrypter{recipients: pgpRecipients}, nil
+	}
+}
+
+// decrypter opens archives that were encrypted to one of its identities.
+type decrypter struct {
+	age []age.Identity
+	pgp openpgp.EntityList
+}
+
+// newDecrypter reads an age identity file or an armored OpenPGP private key. An encrypted private key is unlocked
+// with the passphrase from GITBACK_PASSPHRASE.
+func newDecrypter(identityFile string) (*decrypter, error) {
+	raw, err := os.ReadFile(identityFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read identity %s: %+v", identityFile, err)
+	}
+
+	if bytes.Contains(raw, []byte("AGE-SECRET-KEY-")) {
+		identities, err := age.ParseIdentities(bytes.NewReader(raw))
+		if err != nil {
+			return nil, fmt.Errorf("invalid age identity %s: %+v", identityFile, err)
+		}
+		return &decrypter{age: identities}, nil
+	}
+
+	entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid OpenPGP key %s: %+v", identityFile, err)
+	}
+
+	passphrase := []byte(os.Getenv(passphraseEnv))
+	for _, entity := range entities {
+		if entity.PrivateKey != nil && entity.PrivateKey.Encrypted {
+			if err := entity.PrivateKey.Decrypt(passphrase); err != nil {
+				return nil, fmt.Errorf("failed to unlock OpenPGP key, is %s set? %+v", passphraseEnv, err)
+			}
+		}
+		for _, sub := range entity.Subkeys {
+			if sub.PrivateKey != nil && sub.PrivateKey.Encrypted {
+				if err := sub.PrivateKey.Decrypt(passphrase); err != nil {
+					return nil, fmt.Errorf("failed to unlock OpenPGP key, is %s set? %+v", passphraseEnv, err)
+				}
+			}
+		}
+	}
+	return &decrypter{pgp: entities}, nil
+}
+
+// decrypt detects whether r was encrypted with age or OpenPGP and returns the plaintext.
+func (d *decrypter) decrypt(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	header, _ := br.Peek(len(ageHeader))
+	if string(header) == ageHeader {
+		if len(d.age) == 0 {
+			return nil, fmt.Errorf("archive is encrypted with age, but no age identity was given")
+		}
+		return age.Decrypt(br, d.age...)
+	}
+
+	if len(d.pgp) == 0 {
+		return nil, fmt.Errorf("archive is encrypted with OpenPGP, but no OpenPGP key was given")
+	}
+	md, err := openpgp.ReadMessage(br, d.pgp, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return md.UnverifiedBody, nil
+}
@@ -0,0 +1,155 @@
+package backup
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+)
+
+// pgpKeys writes the armored public and private key of a new OpenPGP key into dir. With a passphrase, the private key
+// is encrypted with it.
+func pgpKeys(t *testing.T, dir string, passphrase string) (string, string) {
+	entity, err := openpgp.NewEntity("test", "", "test@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var public bytes.Buffer
+	w, err := armor.Encode(&public, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	_ = w.Close()
+
+	if passphrase != "" {
+		if err := entity.PrivateKey.Encrypt([]byte(passphrase)); err != nil {
+			t.Fatal(err)
+		}
+		for _, sub := range entity.Subkeys {
+			if err := sub.PrivateKey.Encrypt([]byte(passphrase)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	var private bytes.Buffer
+	w, err = armor.Encode(&private, openpgp.PrivateKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.SerializePrivateWithoutSigning(w, nil); err != nil {
+		t.Fatal(err)
+	}
+	_ = w.Close()
+
+	publicFile := path.Join(dir, "public.asc")
+	privateFile := path.Join(dir, "private.asc")
+	if err := os.WriteFile(publicFile, public.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(privateFile, private.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return publicFile, privateFile
+}
+
+func ageKeys(t *testing.T, dir string) (string, string) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	identityFile := path.Join(dir, "identity.txt")
+	if err := os.WriteFile(identityFile, []byte(identity.String()), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return identity.Recipient().String(), identityFile
+}
+
+func TestCrypt(t *testing.T) {
+	tests := []struct {
+		desc       string
+		keys       func(t *testing.T, dir string) (string, string)
+		passphrase string
+		suffix     string
+	}{
+		{"age", ageKeys, "", ".age"},
+		{"OpenPGP", func(t *testing.T, dir string) (string, string) { return pgpKeys(t, dir, "") }, "", ".gpg"},
+		{"OpenPGP with passphrase", func(t *testing.T, dir string) (string, string) { return pgpKeys(t, dir, "secret") }, "secret", ".gpg"},
+	}
+
+	for _, test := range tests {
+		recipient, identityFile := test.keys(t, t.TempDir())
+		t.Setenv(passphraseEnv, test.passphrase)
+
+		enc, err := newEncrypter(&Encryption{Recipients: []string{recipient}})
+		if err != nil {
+			t.Fatal("failed", test.desc, err)
+		}
+		if enc.suffix() != test.suffix {
+			t.Fatal("failed", test.desc, "got suffix", enc.suffix())
+		}
+
+		var encrypted bytes.Buffer
+		w, err := enc.encrypt(&encrypted)
+		if err != nil {
+			t.Fatal("failed", test.desc, err)
+		}
+		_, _ = w.Write([]byte("bundle"))
+		if err := w.Close(); err != nil {
+			t.Fatal("failed", test.desc, err)
+		}
+		if bytes.Contains(encrypted.Bytes(), []byte("bundle")) {
+			t.Fatal("failed", test.desc, "the plaintext is readable")
+		}
+
+		dec, err := newDecrypter(identityFile)
+		if err != nil {
+			t.Fatal("failed", test.desc, err)
+		}
+		r, err := dec.decrypt(&encrypted)
+		if err != nil {
+			t.Fatal("failed", test.desc, err)
+		}
+		plain, err := io.ReadAll(r)
+		if err != nil || string(plain) != "bundle" {
+			t.Fatal("failed", test.desc, "got", string(plain), err)
+		}
+	}
+}
+
+func TestNewEncrypter_invalid(t *testing.T) {
+	dir := t.TempDir()
+	ageRecipient, _ := ageKeys(t, dir)
+	pgpRecipient, _ := pgpKeys(t, dir, "")
+
+	tests := []struct {
+		desc       string
+		recipients []string
+	}{
+		{"invalid age key", []string{"age1invalid"}},
+		{"missing OpenPGP key", []string{path.Join(dir, "missing.asc")}},
+		{"mixed", []string{ageRecipient, pgpRecipient}},
+	}
+
+	for _, test := range tests {
+		if _, err := newEncrypter(&Encryption{Recipients: test.recipients}); err == nil {
+			t.Fatal("failed", test.desc, "expected an error")
+		}
+	}
+}
+
+func TestNewDecrypter_wrongPassphrase(t *testing.T) {
+	_, identityFile := pgpKeys(t, t.TempDir(), "secret")
+	t.Setenv(passphraseEnv, "wrong")
+	if _, err := newDecrypter(identityFile); err == nil {
+		t.Fatal("expected the wrong passphrase to fail")
+	}
+}
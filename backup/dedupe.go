@@ -0,0 +1,83 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+)
+
+// objectStoreDir holds one shared bare repository per fork network in the backup root.
+const objectStoreDir = ".gitback-objects"
+
+// Network is a group of repositories that share most of their history, e.g., the forks of a project. The objects of
+// all its repositories are stored once in a shared bare repository that each clone borrows from via git alternates.
+type Network struct {
+	Name string `yaml:"name"`
+	// Repositories are patterns in the syntax of path.Match that select the members by name, e.g., */linux.
+	Repositories []string `yaml:"repositories"`
+}
+
+// objectStore returns the shared repository of the network the repository belongs to, or "" if it belongs to none.
+func (c *GoGitBackup) objectStore(name string) string {
+	for _, network := range c.config.Networks {
+		for _, pattern := range network.Repositories {
+			if ok, _ := path.Match(pattern, name); ok {
+				return path.Join(c.config.Repository, objectStoreDir, network.Name+".git")
+			}
+		}
+	}
+	return ""
+}
+
+// share fetches all branches and tags of repo into the shared repository of its network and returns the location of
+// that repository, or "" if repo belongs to no network. The refs of each member are kept below their own namespace,
+// so fetching another member only transfers the objects the network does not have yet.
+func (c *GoGitBackup) share(ctx context.Context, repo Repository) (string, error) {
+	store := c.objectStore(repo.Name)
+	if store == "" {
+		return "", nil
+	}
+
+	r, err := git.PlainOpen(store)
+	if err == git.ErrRepositoryNotExists {
+		r, err = git.PlainInit(store, true)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to open object store %s: %+v", store, err)
+	}
+
+	namespace := "refs/members/" + repo.Name
+	remote := git.NewRemote(r.Storer, &config.RemoteConfig{Name: "origin", URLs: []string{repo.CloneUrl}})
+	err = remote.FetchContext(ctx, &git.FetchOptions{
+		RefSpecs: []config.RefSpec{
+			config.RefSpec("+refs/heads/*:" + namespace + "/heads/*"),
+			config.RefSpec("+refs/tags/*:" + namespace + "/tags/*"),
+		},
+		Tags: git.NoTags,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return "", fmt.Errorf("failed to fetch into object store %s: %+v", store, err)
+	}
+	return store, nil
+}
+
+// borrow makes the repository at location read missing objects from the shared repository store. Objects the
+// repository already has are kept, everything fetched later that the store has is not downloaded again.
+func borrow(location string, store string) error {
+	objects, err := filepath.Abs(path.Join(store, "objects"))
+	if err != nil {
+		return err
+	}
+
+	info := path.Join(location, git.GitDirName, "objects", "info")
+	err = os.MkdirAll(info, 0755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path.Join(info, "alternates"), []byte(objects+"\n"), 0644)
+}
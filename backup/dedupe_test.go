@@ -0,0 +1,99 @@
+package backup
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/cheggaaa/pb/v3"
+	"github.com/go-git/go-git/v5"
+)
+
+func TestGoGitBackup_share(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	upstream := path.Join(dir, "upstream")
+	_, err := git.PlainInit(upstream, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit(t, upstream, "first")
+
+	fork := path.Join(dir, "fork")
+	_, err = git.PlainClone(fork, false, &git.CloneOptions{URL: upstream})
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest := commit(t, fork, "second")
+
+	root := path.Join(dir, "root")
+	c := &GoGitBackup{config: &Config{
+		Repository: root,
+		Networks:   []Network{{Name: "project", Repositories: []string{"*/project"}}},
+	}}
+	st, err := loadState(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bar := pb.New(0)
+
+	repos := []Repository{
+		{Name: "upstream/project", Path: "upstream/project", CloneUrl: upstream},
+		{Name: "fork/project", Path: "fork/project", CloneUrl: fork},
+		{Name: "other/unrelated", Path: "other/unrelated", CloneUrl: upstream},
+	}
+	for _, repo := range repos {
+		err = c.fetch(ctx, bar, st, nil, repo)
+		if err != nil {
+			t.Fatal(repo.Name, err)
+		}
+	}
+
+	for _, name := range []string{"upstream/project", "fork/project"} {
+		location := path.Join(root, name)
+		if _, err := os.Stat(path.Join(location, ".git/objects/info/alternates")); err != nil {
+			t.Fatal("expected", name, "to borrow from the object store", err)
+		}
+		packs, _ := os.ReadDir(path.Join(location, ".git/objects/pack"))
+		if len(packs) > 0 {
+			t.Fatal("expected", name, "to have no objects of its own, got", len(packs), "pack files")
+		}
+	}
+	if _, err := os.Stat(path.Join(root, "other/unrelated/.git/objects/info/alternates")); err == nil {
+		t.Fatal("repositories outside of a network must not borrow objects")
+	}
+
+	r, err := git.PlainOpen(path.Join(root, "fork/project"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, err := r.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.Hash() != latest {
+		t.Fatal("cloned", head.Hash(), "expected", latest)
+	}
+	if _, err := os.Stat(path.Join(root, "fork/project/second")); err != nil {
+		t.Fatal("expected the worktree to be checked out", err)
+	}
+
+	// the store is neither a backed up repository nor an orphan
+	for _, name := range localRepos(root) {
+		if name != "upstream/project" && name != "fork/project" && name != "other/unrelated" {
+			t.Fatal("unexpected repository", name)
+		}
+	}
+
+	commit(t, fork, "third")
+	err = c.fetch(ctx, bar, st, nil, repos[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	packs, _ := os.ReadDir(path.Join(root, "fork/project/.git/objects/pack"))
+	if len(packs) > 0 {
+		t.Fatal("expected the pull to take its objects from the store")
+	}
+}
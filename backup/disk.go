@@ -0,0 +1,101 @@
+package backup
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+)
+
+// estimate is the disk space a clone of repo is expected to take, zero if the provider did not report a size. The
+// providers report the size of the objects, the checked out worktree is assumed to take about as much again. A clone
+// that shares the objects of its fork network only needs space for its worktree.
+func estimate(repo Repository, shared bool) ByteSize {
+	if repo.EstimatedSize <= 0 {
+		return 0
+	}
+	if shared {
+		return repo.EstimatedSize
+	}
+	return 2 * repo.EstimatedSize
+}
+
+// budget tracks the space that is left for new clones on the filesystem of the backup root and in the quota of each
+// account.
+type budget struct {
+	root   string
+	quotas map[string]ByteSize
+	// roots are the roots of the accounts that override the backup root.
+	roots map[string]string
+}
+
+// budget returns the space left in the quota of each account with a quota, based on the size of those of its
+// repositories that are already on disk.
+func (c *GoGitBackup) budget(repos []Repository) *budget {
+	b := &budget{
+		root:   c.config.Repository,
+		quotas: make(map[string]ByteSize),
+		roots:  make(map[string]string),
+	}
+	for _, account := range c.config.Accounts {
+		if account.Quota > 0 {
+			b.quotas[account.Name] = account.Quota
+		}
+		if account.Repository != "" {
+			b.roots[account.Name] = c.settings(account.Name).root
+		}
+	}
+	for _, repo := range repos {
+		if _, ok := b.quotas[repo.ProviderName]; ok {
+			b.quotas[repo.ProviderName] -= dirSize(c.location(repo))
+		}
+	}
+	return b
+}
+
+// reserve checks whether a clone of repo fits and, if it does, deducts it from the quota of its account.
+func (b *budget) reserve(repo Repository, shared bool) error {
+	needed := estimate(repo, shared)
+	if needed == 0 {
+		return nil
+	}
+
+	if left, ok := b.quotas[repo.ProviderName]; ok && needed > left {
+		if left < 0 {
+			left = 0
+		}
+		return fmt.Errorf("needs about %s, but only %s are left in the quota of %s", needed, left, repo.ProviderName)
+	}
+
+	root := b.root
+	if r, ok := b.roots[repo.ProviderName]; ok {
+		root = r
+	}
+	free, err := freeSpace(root)
+	if err != nil {
+		log.Debugf("unable to determine the free space of %s, %+v", root, err)
+	} else if needed > free {
+		return fmt.Errorf("needs about %s, but only %s are free on disk", needed, free)
+	}
+
+	if _, ok := b.quotas[repo.ProviderName]; ok {
+		b.quotas[repo.ProviderName] -= needed
+	}
+	return nil
+}
+
+// dirSize returns the size of all files below dir.
+func dirSize(dir string) ByteSize {
+	var size ByteSize
+	_ = filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += ByteSize(info.Size())
+			}
+		}
+		return nil
+	})
+	return size
+}
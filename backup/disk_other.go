@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package backup
+
+import "errors"
+
+// freeSpace is not supported on this platform, clones are only checked against the quotas.
+func freeSpace(dir string) (ByteSize, error) {
+	return 0, errors.New("free space is not supported on this platform")
+}
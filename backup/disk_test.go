@@ -0,0 +1,47 @@
+package backup
+
+import (
+	"os"
+	"path"
+	"testing"
+)
+
+func TestBudget_reserve(t *testing.T) {
+	root := t.TempDir()
+	err := os.MkdirAll(path.Join(root, "limited/existing"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(path.Join(root, "limited/existing/data"), make([]byte, 1000), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &GoGitBackup{config: &Config{
+		Repository: root,
+		Accounts:   []Account{{Name: "limited", Quota: 5000}, {Name: "unlimited"}},
+	}}
+	existing := Repository{Name: "limited/existing", Path: "limited/existing", ProviderName: "limited"}
+	b := c.budget([]Repository{existing})
+
+	tests := []struct {
+		desc   string
+		repo   Repository
+		shared bool
+		fits   bool
+	}{
+		{"fits into the quota", Repository{ProviderName: "limited", EstimatedSize: 1000}, false, true},
+		{"exceeds the rest of the quota", Repository{ProviderName: "limited", EstimatedSize: 1500}, false, false},
+		{"unknown sizes are not checked", Repository{ProviderName: "limited"}, false, true},
+		{"shared objects only need the worktree", Repository{ProviderName: "limited", EstimatedSize: 1500}, true, true},
+		{"quota is used up", Repository{ProviderName: "limited", EstimatedSize: 1000}, false, false},
+		{"larger than the disk", Repository{ProviderName: "unlimited", EstimatedSize: 1 << 60}, false, false},
+	}
+
+	for _, test := range tests {
+		err := b.reserve(test.repo, test.shared)
+		if (err == nil) != test.fits {
+			t.Fatal("failed", test.desc, "got", err)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+//go:build linux || darwin || freebsd
+
+package backup
+
+import "golang.org/x/sys/unix"
+
+// freeSpace returns the space available to unprivileged users on the filesystem of dir.
+func freeSpace(dir string) (ByteSize, error) {
+	var st unix.Statfs_t
+	err := unix.Statfs(dir, &st)
+	if err != nil {
+		return 0, err
+	}
+	return ByteSize(uint64(st.Bavail) * uint64(st.Bsize)), nil
+}
@@ -0,0 +1,19 @@
+//go:build windows
+
+package backup
+
+import "golang.org/x/sys/windows"
+
+// freeSpace returns the space available to the current user on the volume of dir.
+func freeSpace(dir string) (ByteSize, error) {
+	name, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, err
+	}
+	var available, total, free uint64
+	err = windows.GetDiskFreeSpaceEx(name, &available, &total, &free)
+	if err != nil {
+		return 0, err
+	}
+	return ByteSize(available), nil
+}
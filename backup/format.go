@@ -0,0 +1,52 @@
+package backup
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// parseDocument parses a config in the format given by the extension of file into the node of its top-level mapping.
+// JSON and TOML use the field names of YAML, so all formats share the validation and the schema.
+func parseDocument(file string, raw []byte) (*yaml.Node, error) {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".json":
+		var v interface{}
+		d := json.NewDecoder(bytes.NewReader(raw))
+		d.UseNumber()
+		if err := d.Decode(&v); err != nil {
+			return nil, err
+		}
+		// JSON is YAML as well, which keeps the positions for errors, except for a few escapes such as \/
+		if root, err := document(raw); err == nil {
+			return root, nil
+		}
+		return encodeDocument(v)
+	case ".toml":
+		var v map[string]interface{}
+		if _, err := toml.Decode(string(raw), &v); err != nil {
+			return nil, err
+		}
+		return encodeDocument(v)
+	default:
+		return document(raw)
+	}
+}
+
+// encodeDocument converts a decoded config into a YAML node, errors in it are reported without a position.
+func encodeDocument(v interface{}) (*yaml.Node, error) {
+	var root yaml.Node
+	if v == nil {
+		return &root, nil
+	}
+	err := root.Encode(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert config: %+v", err)
+	}
+	return &root, nil
+}
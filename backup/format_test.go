@@ -0,0 +1,101 @@
+package backup
+
+import (
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigFile_formats(t *testing.T) {
+	dir := t.TempDir()
+	files := []string{
+		writeConfig(t, dir, "yaml/config.yml", `repository: ROOT
+timeout: 2h
+max_bandwidth: 5MiB/s
+accounts:
+  - name: work
+    provider: gitlab
+    token: secret
+    args: [https://gitlab.example.com]
+    quota: 10GB
+    handle_orphaned: remove
+`),
+		writeConfig(t, dir, "json/config.json", `{
+	"repository": "ROOT",
+	"timeout": "2h",
+	"max_bandwidth": "5MiB/s",
+	"accounts": [
+		{
+			"name": "work",
+			"provider": "gitlab",
+			"token": "secret",
+			"args": ["https:\/\/gitlab.example.com"],
+			"quota": "10GB",
+			"handle_orphaned": "remove"
+		}
+	]
+}
+`),
+		writeConfig(t, dir, "toml/config.toml", `repository = "ROOT"
+timeout = "2h"
+max_bandwidth = "5MiB/s"
+
+[[accounts]]
+name = "work"
+provider = "gitlab"
+token = "secret"
+args = ["https://gitlab.example.com"]
+quota = "10GB"
+handle_orphaned = "remove"
+`),
+	}
+
+	var expected *Config
+	for _, file := range files {
+		config, err := LoadConfigFile(file)
+		if err != nil {
+			t.Fatal(file, err)
+		}
+		if expected == nil {
+			expected = config
+		} else if !reflect.DeepEqual(config, expected) {
+			t.Fatalf("%s got\n%+v\nexpected\n%+v", file, config, expected)
+		}
+	}
+	if expected.Accounts[0].Quota != 10e9 || *expected.Accounts[0].HandleOrphaned != RemoveOrphaned {
+		t.Fatal("got", expected.Accounts[0])
+	}
+
+	// fragments can use another format than the main config
+	writeConfig(t, dir, "toml/conf.d/home.json", `{"accounts": [{"name": "home", "provider": "gitea", "token": "secret", "args": ["https://gitea.example.com"]}]}`)
+	config, err := LoadConfigFile(files[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Accounts) != 2 || config.Accounts[1].Provider != Gitea {
+		t.Fatal("got", config.Accounts)
+	}
+
+	tests := []struct {
+		file     string
+		content  string
+		expected string
+	}{
+		{"invalid.json", `{"repository": "ROOT",
+  "timeout": "soon"}`, "invalid.json: line 2, column 14: cannot unmarshal !!str `soon` into time.Duration"},
+		{"syntax.json", `{"repository": }`, "invalid character '}' looking for beginning of value"},
+		{"invalid.toml", `repository = "ROOT"
+[[accounts]]
+name = "work"
+filter = "r := owner"
+`, `invalid.toml: account "work": unknown field "filter" in Account`},
+		{"syntax.toml", `repository = `, "syntax.toml: toml: "},
+	}
+	for _, test := range tests {
+		_, err := LoadConfigFile(writeConfig(t, dir, path.Join("errors", test.file), test.content))
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Fatalf("failed %s, got\n%v\nexpected\n%s", test.file, err, test.expected)
+		}
+	}
+}
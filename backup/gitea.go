@@ -0,0 +1,142 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"code.gitea.io/sdk/gitea"
+	"github.com/d5/tengo/v2"
+)
+
+type _giteaClient struct {
+	Token   string
+	BaseURL string
+	client  *gitea.Client
+	http    *http.Client
+	name    string
+	user    *gitea.User
+	filters []*tengo.Script
+}
+
+func (c *_giteaClient) Init(ctx context.Context) error {
+	if c.BaseURL == "" {
+		return fmt.Errorf("gitea account %s requires the URL of the instance as first argument", c.name)
+	}
+
+	ops := []gitea.ClientOption{gitea.SetToken(c.Token), gitea.SetContext(ctx)}
+	if c.http != nil {
+		ops = append(ops, gitea.SetHTTPClient(c.http))
+	}
+
+	client, err := gitea.NewClient(c.BaseURL, ops...)
+	if err != nil {
+		log.Debugf("failed to create client for %s, %+v", c.BaseURL, err)
+		return err
+	}
+	c.client = client
+
+	user, _, err := client.GetMyUserInfo()
+	if err != nil {
+		return err
+	}
+	c.user = user
+
+	return nil
+}
+
+func (c *_giteaClient) List(ctx context.Context) ([]Repository, error) {
+	c.client.SetContext(ctx)
+
+	repoList := make([]Repository, 0)
+	opt := gitea.ListReposOptions{ListOptions: gitea.ListOptions{Page: 1, PageSize: 50}}
+	for {
+		repos, resp, err := c.client.ListMyRepos(opt)
+		if err != nil {
+			log.Debugf("failed to list Gitea repositories reason %+v", resp)
+			return nil, err
+		}
+
+		for _, repo := range repos {
+			log.Debugf("got %s size %d", repo.FullName, repo.Size)
+
+			r := Repository{
+				CloneUrl:      c.authenticated(repo.CloneURL),
+				Name:          repo.FullName,
+				Description:   repo.Description,
+				Size:          int64(repo.Size),
+				EstimatedSize: ByteSize(repo.Size) << 10, // reported in KiB
+				CreatedAt:     repo.Created.UTC(),
+				Owner:         repo.Owner != nil && repo.Owner.ID == c.user.ID,
+				Member:        true,
+				Visibility:    giteaVisibility(repo),
+				Archived:      repo.Archived,
+				ProviderName:  c.name,
+			}
+
+			if filter(r, c.filters) {
+				repoList = append(repoList, r)
+			}
+		}
+
+		if len(repos) < opt.PageSize {
+			return repoList, nil
+		}
+		opt.Page++
+	}
+}
+
+func (c *_giteaClient) ensure(ctx context.Context, namespace string, name string, visibility Visibility, description string) (string, error) {
+	c.client.SetContext(ctx)
+
+	if namespace == "" {
+		namespace = c.user.UserName
+	}
+
+	repo, resp, err := c.client.GetRepo(namespace, name)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		// Gitea has no internal visibility on creation, keep those repositories private
+		opt := gitea.CreateRepoOption{
+			Name:        name,
+			Description: description,
+			Private:     visibility != Public,
+		}
+
+		log.Debugf("creating Gitea repository %s/%s", namespace, name)
+		if namespace == c.user.UserName {
+			repo, _, err = c.client.CreateRepo(opt)
+		} else {
+			repo, _, err = c.client.CreateOrgRepo(namespace, opt)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return c.authenticated(repo.CloneURL), nil
+}
+
+// authenticated embeds the credentials of the account into an https clone URL.
+func (c *_giteaClient) authenticated(url string) string {
+	return strings.Replace(url, "https://", fmt.Sprintf("https://%s:%s@", c.user.UserName, c.Token), -1)
+}
+
+func giteaVisibility(repo *gitea.Repository) Visibility {
+	switch {
+	case repo.Private:
+		return Private
+	case repo.Internal:
+		return Internal
+	default:
+		return Public
+	}
+}
+
+func (c *_giteaClient) Name() string {
+	return c.name
+}
+
+func (c *_giteaClient) RegisterFilter(filters []*tengo.Script) {
+	c.filters = filters
+}
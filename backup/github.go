@@ -3,6 +3,7 @@ package backup
 import (
 	"context"
 	"fmt"
+	"net/http"
 
 	"strings"
 
@@ -12,8 +13,8 @@ import (
 )
 
 type _githubClient struct {
-	ctx     context.Context
 	client  *github.Client
+	http    *http.Client
 	Token   string
 	User    string
 	name    string
@@ -24,10 +25,11 @@ func (c *_githubClient) Name() string {
 	return c.name
 }
 
-func (c *_githubClient) Init() error {
+func (c *_githubClient) Init(ctx context.Context) error {
 
-	ctx := context.Background()
-	c.ctx = ctx
+	if c.http != nil {
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, c.http)
+	}
 
 	ts := oauth2.StaticTokenSource(
 		&oauth2.Token{AccessToken: c.Token},
@@ -44,7 +46,7 @@ func (c *_githubClient) RegisterFilter(filters []*tengo.Script) {
 	c.filters = filters
 }
 
-func (c *_githubClient) List() ([]Repository, error) {
+func (c *_githubClient) List(ctx context.Context) ([]Repository, error) {
 	repoList := make([]Repository, 0)
 
 	search := &github.RepositoryListOptions{
@@ -59,7 +61,7 @@ func (c *_githubClient) List() ([]Repository, error) {
 	}
 
 	for {
-		list, res, err := c.client.Repositories.List(c.ctx, "", search)
+		list, res, err := c.client.Repositories.List(ctx, "", search)
 
 		if err != nil {
 			log.Debugf("failed to list GitHub repositories reason %+v", res)
@@ -84,15 +86,17 @@ func (c *_githubClient) List() ([]Repository, error) {
 
 			archived := repo != nil && repo.Archived != nil && *repo.Archived
 			r := Repository{
-				CloneUrl:     url,
-				Name:         repo.GetFullName(),
-				Size:         int64(repo.GetSize()),
-				CreatedAt:    repo.GetCreatedAt().UTC(),
-				Owner:        owner,
-				Member:       true,
-				Visibility:   visibility,
-				Archived:     archived,
-				ProviderName: c.name,
+				CloneUrl:      url,
+				Name:          repo.GetFullName(),
+				Description:   repo.GetDescription(),
+				Size:          int64(repo.GetSize()),
+				EstimatedSize: ByteSize(repo.GetSize()) << 10, // reported in KiB
+				CreatedAt:     repo.GetCreatedAt().UTC(),
+				Owner:         owner,
+				Member:        true,
+				Visibility:    visibility,
+				Archived:      archived,
+				ProviderName:  c.name,
 			}
 
 			if filter(r, c.filters) {
@@ -110,3 +114,31 @@ func (c *_githubClient) List() ([]Repository, error) {
 	}
 	return repoList, nil
 }
+
+func (c *_githubClient) ensure(ctx context.Context, namespace string, name string, visibility Visibility, description string) (string, error) {
+	user, _, err := c.client.Users.Get(ctx, "")
+	if err != nil {
+		return "", fmt.Errorf("failed to get the authenticated user: %+v", err)
+	}
+
+	owner, org := namespace, namespace
+	if namespace == "" || namespace == user.GetLogin() {
+		owner, org = user.GetLogin(), ""
+	}
+
+	repo, res, err := c.client.Repositories.Get(ctx, owner, name)
+	if res != nil && res.StatusCode == http.StatusNotFound {
+		log.Debugf("creating GitHub repository %s/%s", owner, name)
+		// GitHub has no internal visibility for personal repositories, keep them private
+		repo, _, err = c.client.Repositories.Create(ctx, org, &github.Repository{
+			Name:        github.String(name),
+			Description: github.String(description),
+			Private:     github.Bool(visibility != Public),
+		})
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Replace(repo.GetCloneURL(), "https://", fmt.Sprintf("https://%s:%s@", user.GetLogin(), c.Token), -1), nil
+}
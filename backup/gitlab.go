@@ -1,7 +1,9 @@
 package backup
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 	"strings"
 
 	"github.com/d5/tengo/v2"
@@ -12,17 +14,21 @@ type _gitlabClient struct {
 	Token   string
 	BaseURL string
 	client  *gitlab.Client
+	http    *http.Client
 	name    string
 	user    *gitlab.User
 	filters []*tengo.Script
 }
 
-func (c *_gitlabClient) Init() error {
+func (c *_gitlabClient) Init(ctx context.Context) error {
 
 	ops := make([]gitlab.ClientOptionFunc, 0)
 	if c.BaseURL != "" {
 		ops = append(ops, gitlab.WithBaseURL(c.BaseURL))
 	}
+	if c.http != nil {
+		ops = append(ops, gitlab.WithHTTPClient(c.http))
+	}
 
 	git, err := gitlab.NewClient(c.Token, ops...)
 
@@ -33,7 +39,7 @@ func (c *_gitlabClient) Init() error {
 
 	c.client = git
 
-	user, _, err := git.Users.CurrentUser()
+	user, _, err := git.Users.CurrentUser(gitlab.WithContext(ctx))
 	if err != nil {
 		return err
 	}
@@ -43,7 +49,7 @@ func (c *_gitlabClient) Init() error {
 	return nil
 }
 
-func (c *_gitlabClient) List() ([]Repository, error) {
+func (c *_gitlabClient) List(ctx context.Context) ([]Repository, error) {
 	//grep all active projects
 	opt := &gitlab.ListProjectsOptions{
 		ListOptions: gitlab.ListOptions{
@@ -54,7 +60,7 @@ func (c *_gitlabClient) List() ([]Repository, error) {
 		Statistics: gitlab.Bool(true),
 	}
 
-	list, err := c.list(opt)
+	list, err := c.list(ctx, opt)
 
 	if err != nil {
 		return nil, err
@@ -64,7 +70,7 @@ func (c *_gitlabClient) List() ([]Repository, error) {
 	opt.Page = 1
 	opt.Archived = gitlab.Bool(true)
 
-	archived, err := c.list(opt)
+	archived, err := c.list(ctx, opt)
 
 	if err != nil {
 		return nil, err
@@ -73,11 +79,11 @@ func (c *_gitlabClient) List() ([]Repository, error) {
 	return append(list, archived...), nil
 }
 
-func (c *_gitlabClient) list(opt *gitlab.ListProjectsOptions) ([]Repository, error) {
+func (c *_gitlabClient) list(ctx context.Context, opt *gitlab.ListProjectsOptions) ([]Repository, error) {
 	repoList := make([]Repository, 0)
 
 	for {
-		projects, resp, err := c.client.Projects.ListProjects(opt)
+		projects, resp, err := c.client.Projects.ListProjects(opt, gitlab.WithContext(ctx))
 
 		if err != nil {
 			log.Debugf("failed to list GitHub repositories reason %+v", resp)
@@ -87,7 +93,7 @@ func (c *_gitlabClient) list(opt *gitlab.ListProjectsOptions) ([]Repository, err
 		for _, project := range projects {
 			log.Debugf("got %s", project.Name)
 
-			r := c.generate(project)
+			r := c.generate(ctx, project)
 
 			if filter(r, c.filters) {
 				repoList = append(repoList, r)
@@ -103,17 +109,19 @@ func (c *_gitlabClient) list(opt *gitlab.ListProjectsOptions) ([]Repository, err
 	}
 }
 
-func (c *_gitlabClient) generate(project *gitlab.Project) Repository {
+func (c *_gitlabClient) generate(ctx context.Context, project *gitlab.Project) Repository {
 
 	var size int64
+	var estimated ByteSize
 	if project.Statistics != nil {
 		size = project.Statistics.StorageSize
+		estimated = ByteSize(project.Statistics.RepositorySize)
 	} else {
 		size = -1
 	}
 
 	isMember := false
-	members, _, err := c.client.ProjectMembers.ListAllProjectMembers(project.ID, nil)
+	members, _, err := c.client.ProjectMembers.ListAllProjectMembers(project.ID, nil, gitlab.WithContext(ctx))
 	if err == nil {
 		for _, m := range members {
 			if m.ID == c.user.ID {
@@ -137,21 +145,61 @@ func (c *_gitlabClient) generate(project *gitlab.Project) Repository {
 	}
 
 	r := Repository{
-		CloneUrl:     strings.Replace(project.HTTPURLToRepo, "https://", fmt.Sprintf("https://oauth2:%s@", c.Token), -1),
-		Name:         strings.ReplaceAll(strings.ReplaceAll(project.NameWithNamespace, " / ", "/"), " ", "_"),
-		Size:         size,
-		CreatedAt:    *project.CreatedAt,
-		Owner:        project.Owner != nil && project.Owner.ID == c.user.ID,
-		Member:       isMember,
-		Visibility:   visibility,
-		Archived:     project.Archived,
-		ProviderName: c.name,
+		CloneUrl:      strings.Replace(project.HTTPURLToRepo, "https://", fmt.Sprintf("https://oauth2:%s@", c.Token), -1),
+		Name:          strings.ReplaceAll(strings.ReplaceAll(project.NameWithNamespace, " / ", "/"), " ", "_"),
+		Description:   project.Description,
+		Size:          size,
+		EstimatedSize: estimated,
+		CreatedAt:     *project.CreatedAt,
+		Owner:         project.Owner != nil && project.Owner.ID == c.user.ID,
+		Member:        isMember,
+		Visibility:    visibility,
+		Archived:      project.Archived,
+		ProviderName:  c.name,
 	}
 
 	log.Debugf("got %s %+v %+v %+v", r.Name, r.Member, r.Owner, r.Size)
 	return r
 }
 
+func (c *_gitlabClient) ensure(ctx context.Context, namespace string, name string, visibility Visibility, description string) (string, error) {
+	if namespace == "" {
+		namespace = c.user.Username
+	}
+
+	project, resp, err := c.client.Projects.GetProject(namespace+"/"+name, nil, gitlab.WithContext(ctx))
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		ns, _, err := c.client.Namespaces.GetNamespace(namespace, gitlab.WithContext(ctx))
+		if err != nil {
+			return "", fmt.Errorf("failed to find namespace %s: %+v", namespace, err)
+		}
+
+		vis := gitlab.PrivateVisibility
+		switch visibility {
+		case Public:
+			vis = gitlab.PublicVisibility
+		case Internal:
+			vis = gitlab.InternalVisibility
+		}
+
+		log.Debugf("creating GitLab project %s/%s", namespace, name)
+		project, _, err = c.client.Projects.CreateProject(&gitlab.CreateProjectOptions{
+			Name:        gitlab.String(name),
+			Path:        gitlab.String(name),
+			NamespaceID: gitlab.Int(ns.ID),
+			Description: gitlab.String(description),
+			Visibility:  gitlab.Visibility(vis),
+		}, gitlab.WithContext(ctx))
+		if err != nil {
+			return "", err
+		}
+	} else if err != nil {
+		return "", err
+	}
+
+	return strings.Replace(project.HTTPURLToRepo, "https://", fmt.Sprintf("https://oauth2:%s@", c.Token), -1), nil
+}
+
 func (c *_gitlabClient) Name() string {
 	return c.name
 }
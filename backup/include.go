@@ -0,0 +1,167 @@
+package backup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// confDir is the directory next to a config whose fragments are merged into it.
+const confDir = "conf.d"
+
+// LoadConfigFile loads the config at file like LoadConfig, merged with the fragments matched by its include patterns
+// and the *.yml, *.yaml, *.json and *.toml files in the conf.d directory next to it. Fragments are merged in that
+// order, each sorted by name. Lists, e.g., accounts, are appended to, all other top-level keys can only be set in one
+// file. Each file is read as JSON or TOML if it has that extension, and as YAML otherwise. Problems are reported with
+// the file they are in.
+func LoadConfigFile(file string) (*Config, error) {
+	root, v, err := mergeDocuments(file)
+	if err != nil {
+		return nil, err
+	}
+	return v.load(root)
+}
+
+// mergeDocuments reads the config at file and merges its fragments into it, without validating the result.
+func mergeDocuments(file string) (*yaml.Node, *validator, error) {
+	root, err := readDocument(file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if root.Kind == 0 {
+		// an empty main config, everything is in the fragments
+		root.Kind, root.Tag = yaml.MappingNode, "!!map"
+	}
+	v := &validator{files: make(map[*yaml.Node]string)}
+	v.track(root, file)
+
+	fragments, err := fragments(file, root)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, fragment := range fragments {
+		n, err := readDocument(fragment)
+		if err != nil {
+			return nil, nil, err
+		}
+		v.track(n, fragment)
+		v.merge(root, n)
+	}
+	if len(v.errors) > 0 {
+		return nil, nil, v.errors
+	}
+	return root, v, nil
+}
+
+func readDocument(file string) (*yaml.Node, error) {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config at %s %+v", file, err)
+	}
+	root, err := parseDocument(file, raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %+v", file, err)
+	}
+	return root, nil
+}
+
+// fragments returns the files included by the config at file with the document root, followed by those in its conf.d
+// directory.
+func fragments(file string, root *yaml.Node) ([]string, error) {
+	dir := filepath.Dir(file)
+
+	patterns := make([]string, 0)
+	if include := node(root, "include"); include != root && include.Kind == yaml.SequenceNode {
+		for _, pattern := range include.Content {
+			patterns = append(patterns, pattern.Value)
+		}
+	}
+
+	files := make([]string, 0)
+	seen := map[string]struct{}{filepath.Clean(file): {}}
+	add := func(pattern string, required bool) error {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid include pattern %s: %+v", pattern, err)
+		}
+		// a pattern without wildcards names a single file, which has to exist
+		if len(matches) == 0 && required && !strings.ContainsAny(pattern, "*?[") {
+			return fmt.Errorf("included config %s does not exist", pattern)
+		}
+		sort.Strings(matches)
+		for _, match := range matches {
+			if _, ok := seen[filepath.Clean(match)]; !ok {
+				seen[filepath.Clean(match)] = struct{}{}
+				files = append(files, match)
+			}
+		}
+		return nil
+	}
+
+	for _, pattern := range patterns {
+		if err := add(pattern, true); err != nil {
+			return nil, err
+		}
+	}
+	for _, pattern := range []string{"*.yml", "*.yaml", "*.json", "*.toml"} {
+		if err := add(filepath.Join(confDir, pattern), false); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// track records file as the origin of n and all nodes below it.
+func (v *validator) track(n *yaml.Node, file string) {
+	v.files[n] = file
+	for _, child := range n.Content {
+		v.track(child, file)
+	}
+}
+
+// merge adds the top-level keys of the fragment src to the config dst.
+func (v *validator) merge(dst *yaml.Node, src *yaml.Node) {
+	if src.Kind == 0 || (src.Kind == yaml.ScalarNode && src.Tag == "!!null") {
+		// an empty fragment
+		return
+	}
+	if src.Kind != yaml.MappingNode || dst.Kind != yaml.MappingNode {
+		v.errorf(src, "expected a mapping")
+		return
+	}
+
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+		if key.Value == "include" {
+			v.errorf(key, "include is only supported in the main config")
+			continue
+		}
+
+		j := 0
+		for j < len(dst.Content) && dst.Content[j].Value != key.Value {
+			j += 2
+		}
+		if j+1 >= len(dst.Content) {
+			dst.Content = append(dst.Content, key, value)
+			continue
+		}
+
+		existing := dst.Content[j+1]
+		switch {
+		case existing.Kind == yaml.ScalarNode && existing.Tag == "!!null":
+			dst.Content[j+1] = value
+		case existing.Kind == yaml.SequenceNode && value.Kind == yaml.SequenceNode:
+			existing.Content = append(existing.Content, value.Content...)
+		default:
+			v.errorf(key, "%s is already set in %s, line %d", key.Value, v.files[existing], existing.Line)
+		}
+	}
+}
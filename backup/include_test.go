@@ -0,0 +1,90 @@
+package backup
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+// writeConfig writes a config file below dir, ROOT in its content is replaced by dir.
+func writeConfig(t *testing.T, dir string, name string, content string) string {
+	file := path.Join(dir, name)
+	if err := os.MkdirAll(path.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte(strings.ReplaceAll(content, "ROOT", dir)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	main := writeConfig(t, dir, "config.yml", `repository: ROOT
+include: [teams/*.yml]
+accounts:
+  - name: central
+    provider: github
+    token: secret
+    args: [backup]
+`)
+	writeConfig(t, dir, "teams/platform.yml", `accounts:
+  - name: platform
+    provider: gitlab
+    token: secret
+networks:
+  - name: linux
+    repositories: ["*/linux"]
+`)
+	writeConfig(t, dir, "conf.d/alice.yml", `accounts:
+  - name: alice
+    provider: github
+    token: secret
+    args: [alice]
+`)
+	writeConfig(t, dir, "conf.d/empty.yaml", ``)
+
+	config, err := LoadConfigFile(main)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0)
+	for _, account := range config.Accounts {
+		names = append(names, account.Name)
+	}
+	if strings.Join(names, ",") != "central,platform,alice" || len(config.Networks) != 1 {
+		t.Fatal("got", names, config.Networks)
+	}
+
+	bob := writeConfig(t, dir, "conf.d/bob.yml", `timeout: 1h
+accounts:
+  - name: alice
+    provider: github
+    token: secret
+    args: [bob]
+`)
+	_, err = LoadConfigFile(main)
+	expected := bob + `: line 3, column 11: duplicate account name "alice"`
+	if err == nil || err.Error() != expected {
+		t.Fatalf("got\n%v\nexpected\n%s", err, expected)
+	}
+
+	writeConfig(t, dir, "config.yml", `repository: ROOT
+timeout: 2h
+include: [teams/missing.yml]
+`)
+	_, err = LoadConfigFile(main)
+	if err == nil || !strings.Contains(err.Error(), "missing.yml does not exist") {
+		t.Fatal("expected a missing include to fail, got", err)
+	}
+
+	writeConfig(t, dir, "config.yml", `repository: ROOT
+timeout: 2h
+`)
+	_, err = LoadConfigFile(main)
+	expected = bob + ": line 1, column 1: timeout is already set in " + main + ", line 2"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("got\n%v\nexpected\n%s", err, expected)
+	}
+}
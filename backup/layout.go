@@ -0,0 +1,245 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// defaultLayout places each repository at its full name below the backup root, the layout of all versions before
+// layouts were configurable.
+const defaultLayout = "{{.Namespace}}/{{.Repo}}"
+
+// layoutFields are the fields available to a layout template.
+type layoutFields struct {
+	// Account is the name of the account the repository was listed by.
+	Account string
+	// Provider is the name of the provider of the account, e.g., github.
+	Provider string
+	// Namespace is the owner, organization or group of the repository, nested groups are separated by /.
+	Namespace string
+	// Repo is the name of the repository without its namespace.
+	Repo string
+	// Name is the full name of the repository, i.e., Namespace/Repo.
+	Name string
+}
+
+// parseLayout parses a layout template, an empty layout is the default one.
+func parseLayout(name string, layout string) (*template.Template, error) {
+	if layout == "" {
+		layout = defaultLayout
+	}
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(layout)
+	if err != nil {
+		return nil, fmt.Errorf("invalid layout %q: %+v", layout, err)
+	}
+	// catch unknown fields now instead of during the first backup
+	_, err = locate(tmpl, Account{}, Repository{Name: "namespace/repo"})
+	if err != nil {
+		return nil, fmt.Errorf("invalid layout %q: %+v", layout, err)
+	}
+	return tmpl, nil
+}
+
+// locate returns the location of repo relative to the backup root according to the layout tmpl.
+func locate(tmpl *template.Template, account Account, repo Repository) (string, error) {
+	namespace, base := splitName(repo.Name)
+
+	var sb strings.Builder
+	err := tmpl.Execute(&sb, layoutFields{
+		Account:   account.Name,
+		Provider:  account.Provider.String(),
+		Namespace: namespace,
+		Repo:      base,
+		Name:      repo.Name,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	location := path.Clean("/" + sb.String())[1:]
+	if location == "" || strings.HasPrefix(location, ".gitback") {
+		return "", fmt.Errorf("layout produced the invalid location %q for %s", sb.String(), repo.Name)
+	}
+	return location, nil
+}
+
+// splitName splits the full name of a repository into its namespace, which is empty for names without one, and base.
+func splitName(name string) (string, string) {
+	namespace := path.Dir(name)
+	if namespace == "." {
+		namespace = ""
+	}
+	return namespace, path.Base(name)
+}
+
+// location returns the directory repo is backed up in.
+func (c *GoGitBackup) location(repo Repository) string {
+	return path.Join(c.config.Repository, repo.Path)
+}
+
+// migrate moves the clones of repos that are still at the location of a previous layout to their current location,
+// so that changing the layout does not clone everything again. A clone that cannot be moved is left where it is and
+// cloned again. The previous location is taken from the state, or is
+// the default layout for clones the state does not know.
+func (c *GoGitBackup) migrate(st *state, repos []Repository) error {
+	claimed := make(map[string]struct{}, len(repos))
+	for _, repo := range repos {
+		claimed[repo.Path] = struct{}{}
+	}
+
+	moves := make(map[string]string)
+	for _, repo := range repos {
+		target := c.location(repo)
+		if _, err := os.Stat(target); err == nil {
+			continue
+		}
+
+		previous := ""
+		for key, r := range st.Repositories {
+			if key != repo.Path && r.Account == repo.ProviderName && (r.Name == repo.Name || (r.Name == "" && key == repo.Name)) {
+				previous = key
+				break
+			}
+		}
+		if _, ok := st.Repositories[repo.Name]; previous == "" && !ok {
+			if _, ok := claimed[repo.Name]; !ok {
+				previous = repo.Name
+			}
+		}
+		if previous == "" || previous == repo.Path {
+			continue
+		}
+
+		source := path.Join(c.config.Repository, previous)
+		if _, err := os.Stat(path.Join(source, ".git")); err != nil {
+			continue
+		}
+
+		log.Infof("Moving %s to %s", source, target)
+		err := move(source, target)
+		if err != nil {
+			// nothing is at the new location, the backup clones the repository again
+			log.Errorf("Failed to move %s to %s, it is cloned again: %+v", source, target, err)
+			continue
+		}
+		removeEmptyParents(c.config.Repository, source)
+
+		if r, ok := st.Repositories[previous]; ok {
+			delete(st.Repositories, previous)
+			// the archives are named after the location, an increment under the new one would have no full bundle
+			r.Bundled = nil
+			st.Repositories[repo.Path] = r
+		}
+		moves[previous] = repo.Path
+	}
+
+	if len(moves) == 0 {
+		return nil
+	}
+	err := c.moveSnapshots(moves)
+	if err != nil {
+		return err
+	}
+	return st.save()
+}
+
+// move moves the directory source to target. If it cannot be renamed, e.g., because target is on another file system,
+// it is copied and removed afterwards. The copy is staged, so a failed one never looks like a clone.
+func move(source string, target string) error {
+	err := os.MkdirAll(path.Dir(target), 0755)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(source, target)
+	if err == nil {
+		return nil
+	}
+	log.Debugf("failed to rename %s, copying it: %+v", source, err)
+
+	staging, err := os.MkdirTemp(path.Dir(target), stagingPrefix+path.Base(target)+"-")
+	if err != nil {
+		return err
+	}
+	err = copyTree(source, staging)
+	if err == nil {
+		err = os.Rename(staging, target)
+	}
+	if err != nil {
+		_ = os.RemoveAll(staging)
+		return err
+	}
+
+	err = os.RemoveAll(source)
+	if err != nil {
+		log.Warnf("Failed to remove %s after copying it to %s: %+v", source, target, err)
+	}
+	return nil
+}
+
+// copyTree copies the files, directories and symlinks below source into the existing directory target.
+func copyTree(source string, target string) error {
+	return filepath.WalkDir(source, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(source, file)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(target, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(dst, info.Mode().Perm())
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(file)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, dst)
+		case d.Type().IsRegular():
+			return copyFile(file, dst, info.Mode().Perm())
+		}
+		return fmt.Errorf("cannot copy %s of type %s", file, d.Type())
+	})
+}
+
+func copyFile(source string, target string, mode fs.FileMode) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// removeEmptyParents removes the directories between location and root that became empty after location was moved.
+func removeEmptyParents(root string, location string) {
+	for dir := path.Dir(location); dir != path.Clean(root) && strings.HasPrefix(dir, path.Clean(root)); dir = path.Dir(dir) {
+		err := os.Remove(dir)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package backup
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+)
+
+func TestLocate(t *testing.T) {
+	account := Account{Name: "work", Provider: GitLab}
+	tests := []struct {
+		desc     string
+		layout   string
+		name     string
+		expected string
+		fails    bool
+	}{
+		{"default layout", "", "group/sub/project", "group/sub/project", false},
+		{"account prefix", "{{.Account}}/{{.Namespace}}/{{.Repo}}", "me/project", "work/me/project", false},
+		{"provider and name", "{{.Provider}}/{{.Name}}", "me/project", "gitlab/me/project", false},
+		{"no namespace", "{{.Account}}/{{.Namespace}}/{{.Repo}}", "project", "work/project", false},
+		{"stays below the root", "../../{{.Repo}}", "me/project", "project", false},
+		{"reserved names", ".gitback-objects/{{.Repo}}", "me/project", "", true},
+		{"empty location", "{{.Namespace}}", "project", "", true},
+	}
+
+	for _, test := range tests {
+		var location string
+		tmpl, err := parseLayout(account.Name, test.layout)
+		if err == nil {
+			location, err = locate(tmpl, account, Repository{Name: test.name})
+		}
+		if (err != nil) != test.fails {
+			t.Fatal("failed", test.desc, "unexpected error", err)
+		}
+		if location != test.expected {
+			t.Fatal("failed", test.desc, "got", location, "expected", test.expected)
+		}
+	}
+
+	if _, err := parseLayout("unknown", "{{.Owner}}"); err == nil {
+		t.Fatal("expected unknown fields to be rejected")
+	}
+}
+
+func TestGoGitBackup_migrate(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"me/legacy", "old/recorded"} {
+		if _, err := git.PlainInit(path.Join(root, name), false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	st, err := loadState(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.succeeded("old/recorded", Repository{Name: "me/recorded", ProviderName: "work"}, nil)
+	st.bundled("old/recorded", root, map[string]string{"refs/heads/master": "0123"})
+
+	c := &GoGitBackup{config: &Config{Repository: root}}
+	err = c.writeSnapshot(&snapshot{ID: "pinned", Repositories: map[string]map[string]string{"old/recorded": {}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	repos := []Repository{
+		{Name: "me/legacy", Path: "work/me/legacy", ProviderName: "work"},
+		{Name: "me/recorded", Path: "work/me/recorded", ProviderName: "work"},
+		{Name: "me/new", Path: "work/me/new", ProviderName: "work"},
+	}
+	err = c.migrate(st, repos)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"work/me/legacy", "work/me/recorded"} {
+		if _, err := os.Stat(path.Join(root, name, ".git")); err != nil {
+			t.Fatal("expected", name, "to be moved", err)
+		}
+	}
+	for _, name := range []string{"me", "old", "work/me/new"} {
+		if _, err := os.Stat(path.Join(root, name)); err == nil {
+			t.Fatal("expected", name, "to not exist")
+		}
+	}
+
+	saved, err := loadState(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, ok := saved.Repositories["work/me/recorded"]; !ok || r.Name != "me/recorded" {
+		t.Fatal("expected the state to follow the move, got", saved.Repositories)
+	} else if len(r.Bundled) != 0 {
+		t.Fatal("expected the next archive of a moved repository to be a full bundle, got the tips", r.Bundled)
+	}
+	if _, ok := saved.Repositories["old/recorded"]; ok {
+		t.Fatal("expected the previous location to be removed from the state")
+	}
+
+	snapshots, err := c.snapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := snapshots[0].Repositories["work/me/recorded"]; !ok || len(snapshots[0].Repositories) != 1 {
+		t.Fatal("expected the snapshot to follow the move, got", snapshots[0].Repositories)
+	}
+}
+
+func TestCopyTree(t *testing.T) {
+	dir := t.TempDir()
+	source := path.Join(dir, "source")
+	if _, err := git.PlainInit(source, false); err != nil {
+		t.Fatal(err)
+	}
+	commit(t, source, "README")
+	if err := os.Symlink("README", path.Join(source, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	target := path.Join(dir, "target")
+	if err := os.Mkdir(target, 0755); err != nil {
+		t.Fatal(err)
+	}
+	err := copyTree(source, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := git.PlainOpen(target)
+	if err != nil {
+		t.Fatal("expected the copy to be a repository", err)
+	}
+	if _, err := r.Head(); err != nil {
+		t.Fatal("expected the copy to have the commit", err)
+	}
+	if link, err := os.Readlink(path.Join(target, "link")); err != nil || link != "README" {
+		t.Fatal("expected the symlink to be copied, got", link, err)
+	}
+}
+
+func TestGoGitBackup_migrate_failure(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"me/blocked", "me/free"} {
+		if _, err := git.PlainInit(path.Join(root, name), false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a file where the new location of the first repository needs a directory
+	if err := os.WriteFile(path.Join(root, "file"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := loadState(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &GoGitBackup{config: &Config{Repository: root}}
+	err = c.migrate(st, []Repository{
+		{Name: "me/blocked", Path: "file/me/blocked", ProviderName: "work"},
+		{Name: "me/free", Path: "work/me/free", ProviderName: "work"},
+	})
+	if err != nil {
+		t.Fatal("a failed move must not stop the others", err)
+	}
+	if _, err := os.Stat(path.Join(root, "me/blocked/.git")); err != nil {
+		t.Fatal("expected the blocked repository to stay", err)
+	}
+	if _, err := os.Stat(path.Join(root, "work/me/free/.git")); err != nil {
+		t.Fatal("expected the other repository to be moved", err)
+	}
+}
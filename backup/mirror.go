@@ -0,0 +1,191 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/template"
+
+	"github.com/cheggaaa/pb/v3"
+)
+
+// skipVisibility excludes the repositories of a visibility from a mirror.
+const skipVisibility = "skip"
+
+// Mirror keeps a destination account in sync with the repositories listed by a source account.
+type Mirror struct {
+	// Source and Destination are the names of configured accounts, the destination has to support pushing.
+	Source      string `yaml:"source"`
+	Destination string `yaml:"destination"`
+	// Namespace is the group or organization the mirrors are created in, defaults to the authenticated user.
+	Namespace string `yaml:"namespace"`
+	// Name is a template for the name of each mirror with the fields .Name, .Namespace and .Base of the source
+	// repository, defaults to {{.Base}}.
+	Name string `yaml:"name"`
+	// Visibility maps the visibility of a source repository (public, internal or private) to the one of its mirror,
+	// or to skip to leave it out. Visibilities that are not mapped are kept.
+	Visibility map[string]string `yaml:"visibility"`
+}
+
+// mirrorRule is a Mirror with its name template parsed.
+type mirrorRule struct {
+	*Mirror
+	name *template.Template
+}
+
+func newMirrorRule(m *Mirror) (*mirrorRule, error) {
+	for from, to := range m.Visibility {
+		// parseVisibility falls back to private, only known names survive the round trip
+		if parseVisibility(from).String() != from || (to != skipVisibility && parseVisibility(to).String() != to) {
+			return nil, fmt.Errorf("invalid visibility rule %s: %s", from, to)
+		}
+	}
+
+	tmpl, err := parseTargetName(m.Source, m.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &mirrorRule{Mirror: m, name: tmpl}, nil
+}
+
+// target returns the name and visibility of the mirror of repo, ok is false if repo is not mirrored.
+func (r *mirrorRule) target(repo Repository) (name string, visibility Visibility, ok bool, err error) {
+	visibility = repo.Visibility
+	if to, mapped := r.Visibility[repo.Visibility.String()]; mapped {
+		if to == skipVisibility {
+			return "", visibility, false, nil
+		}
+		visibility = parseVisibility(to)
+	}
+
+	name, err = targetName(r.name, repo.Name)
+	if err != nil {
+		return "", visibility, false, err
+	}
+	return name, visibility, true, nil
+}
+
+// Mirror fetches every repository of the source account of each configured mirror into the backup root and pushes
+// all of its branches and tags to the destination account afterwards. Missing repositories are created on the
+// destination.
+func (c *GoGitBackup) Mirror(ctx context.Context) error {
+	if len(c.config.Mirrors) == 0 {
+		return fmt.Errorf("no mirrors configured")
+	}
+
+	st, err := loadState(c.config.Repository)
+	if err != nil {
+		return err
+	}
+
+	for _, root := range c.roots() {
+		cleanStaging(root)
+	}
+
+	failed := 0
+	for i := range c.config.Mirrors {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		m := &c.config.Mirrors[i]
+		n, err := c.mirror(ctx, st, m)
+		if err != nil {
+			return fmt.Errorf("mirror %s to %s: %+v", m.Source, m.Destination, err)
+		}
+		failed += n
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to mirror %d repositories", failed)
+	}
+	return ctx.Err()
+}
+
+// mirror runs a single mirror and returns the number of repositories that failed.
+func (c *GoGitBackup) mirror(ctx context.Context, st *state, m *Mirror) (int, error) {
+	rule, err := newMirrorRule(m)
+	if err != nil {
+		return 0, err
+	}
+
+	source, ok := c.accounts[m.Source]
+	if !ok {
+		return 0, fmt.Errorf("account %s is not configured", m.Source)
+	}
+	target, ok := c.accounts[m.Destination].(destination)
+	if !ok {
+		return 0, fmt.Errorf("account %s is not configured or does not support pushing", m.Destination)
+	}
+
+	for _, cl := range []client{source, target} {
+		if err := cl.Init(ctx); err != nil {
+			return 0, fmt.Errorf("failed to init client %s: %+v", cl.Name(), err)
+		}
+	}
+	repos, err := c.list(ctx, source)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list repositories of %s: %+v", m.Source, err)
+	}
+
+	// with nested groups, two repositories can map to the same mirror, the second push would overwrite the first
+	mirrored := make(map[string]string)
+	for _, repo := range repos {
+		name, _, ok, err := rule.target(repo)
+		if err != nil || !ok {
+			continue
+		}
+		if other, taken := mirrored[name]; taken {
+			return 0, fmt.Errorf("%s and %s would both be mirrored to %s, use a name template that tells them apart, e.g., {{.Namespace}}-{{.Base}}", other, repo.Name, name)
+		}
+		mirrored[name] = repo.Name
+	}
+
+	err = c.migrate(st, repos)
+	if err != nil {
+		return 0, fmt.Errorf("failed to migrate to the layout: %+v", err)
+	}
+
+	space := c.budget(repos)
+	bar := pb.ProgressBarTemplate(progressTemplate).New(len(repos)).SetWriter(os.Stdout).Start()
+	defer bar.Finish()
+
+	failed := 0
+	for _, repo := range repos {
+		if ctx.Err() != nil {
+			break
+		}
+		bar.Increment()
+
+		name, visibility, ok, err := rule.target(repo)
+		if err != nil {
+			c._error(bar, fmt.Sprintf("Failed to map %s - %+v", repo.Name, err))
+			failed++
+			continue
+		} else if !ok {
+			c._info(bar, fmt.Sprintf("Skipping %s, %s repositories are not mirrored", repo.Name, repo.Visibility))
+			continue
+		}
+
+		if c.fetch(ctx, bar, st, space, repo) != nil {
+			failed++
+			continue
+		}
+
+		c._info(bar, fmt.Sprintf("Pushing %s to %s", repo.Name, m.Destination))
+		url, err := target.ensure(ctx, m.Namespace, name, visibility, repo.Description)
+		if err != nil {
+			c._error(bar, fmt.Sprintf("Failed to create %s on %s - %+v", name, m.Destination, err))
+			failed++
+			continue
+		}
+
+		opCtx, watchdog, cancel := c.guard(ctx, m.Destination)
+		err = watchdog.explain(opCtx, push(opCtx, c.location(repo), url, true))
+		cancel()
+		if err != nil {
+			c._error(bar, fmt.Sprintf("Failed to push %s - %+v", repo.Name, err))
+			failed++
+		}
+	}
+	return failed, nil
+}
@@ -0,0 +1,65 @@
+package backup
+
+import "testing"
+
+func TestMirrorRule_target(t *testing.T) {
+	tests := []struct {
+		desc       string
+		mirror     Mirror
+		repo       Repository
+		name       string
+		visibility Visibility
+		ok         bool
+	}{
+		{
+			desc:       "defaults keep the base name and visibility",
+			mirror:     Mirror{},
+			repo:       Repository{Name: "group/sub/project", Visibility: Internal},
+			name:       "project",
+			visibility: Internal,
+			ok:         true,
+		},
+		{
+			desc:       "name template is flattened",
+			mirror:     Mirror{Name: "{{.Namespace}}/{{.Base}}"},
+			repo:       Repository{Name: "group/sub/project", Visibility: Public},
+			name:       "group-sub-project",
+			visibility: Public,
+			ok:         true,
+		},
+		{
+			desc:       "visibility is mapped",
+			mirror:     Mirror{Visibility: map[string]string{"internal": "private"}},
+			repo:       Repository{Name: "group/project", Visibility: Internal},
+			name:       "project",
+			visibility: Private,
+			ok:         true,
+		},
+		{
+			desc:   "visibility is skipped",
+			mirror: Mirror{Visibility: map[string]string{"private": "skip"}},
+			repo:   Repository{Name: "group/project", Visibility: Private},
+			ok:     false,
+		},
+	}
+
+	for _, test := range tests {
+		rule, err := newMirrorRule(&test.mirror)
+		if err != nil {
+			t.Fatal("failed", test.desc, err)
+		}
+		name, visibility, ok, err := rule.target(test.repo)
+		if err != nil {
+			t.Fatal("failed", test.desc, err)
+		}
+		if ok != test.ok || (ok && (name != test.name || visibility != test.visibility)) {
+			t.Fatal("failed", test.desc, "got", name, visibility, ok, "expected", test.name, test.visibility, test.ok)
+		}
+	}
+
+	for _, invalid := range []map[string]string{{"secret": "private"}, {"public": "hidden"}, {"skip": "public"}} {
+		if _, err := newMirrorRule(&Mirror{Visibility: invalid}); err == nil {
+			t.Fatal("expected an error for", invalid)
+		}
+	}
+}
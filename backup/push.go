@@ -0,0 +1,263 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/cheggaaa/pb/v3"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	gittransport "github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+// pushRemote is the name of the in-memory remote used to push, it is never written to the repository config.
+const pushRemote = "gitback-push"
+
+// defaultTargetName names a pushed repository after the base name of its source.
+const defaultTargetName = "{{.Base}}"
+
+// Push pushes every branch and tag of the repositories in dir to the account, below namespace or the authenticated
+// user if it is empty. Each repository is named by the template nameTemplate, see parseTargetName. Missing
+// repositories are created with the visibility and description recorded during the backup. With names, only the named
+// repositories and everything below them are pushed. Nothing is pushed if two repositories would get the same name.
+func (c *GoGitBackup) Push(ctx context.Context, dir string, names []string, account string, namespace string, nameTemplate string) error {
+	if dir == "" {
+		dir = c.config.Repository
+	}
+	tmpl, err := parseTargetName(account, nameTemplate)
+	if err != nil {
+		return err
+	}
+
+	target, ok := c.accounts[account].(destination)
+	if !ok {
+		return fmt.Errorf("account %s is not configured or does not support pushing", account)
+	}
+	st, err := loadState(c.config.Repository)
+	if err != nil {
+		return err
+	}
+
+	selected := make([]string, 0)
+	targets := make(map[string]string)
+	sources := make(map[string]string)
+	for _, name := range localRepos(dir) {
+		if !matches(name, names) {
+			continue
+		}
+		// the full name on the provider keeps its namespace if a layout dropped it from the location
+		full := name
+		if r, ok := st.Repositories[name]; ok && r.Name != "" {
+			full = r.Name
+		}
+		targets[name], err = targetName(tmpl, full)
+		if err != nil {
+			return err
+		}
+		if other, ok := sources[targets[name]]; ok {
+			return fmt.Errorf("%s and %s would both be pushed to %s, use a name template that tells them apart, e.g., {{.Namespace}}-{{.Base}}", other, name, targets[name])
+		}
+		sources[targets[name]] = name
+		selected = append(selected, name)
+	}
+
+	err = target.Init(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to init client %s: %+v", account, err)
+	}
+
+	bar := pb.ProgressBarTemplate(progressTemplate).New(len(selected)).SetWriter(os.Stdout).Start()
+	defer bar.Finish()
+
+	failed := 0
+	for _, name := range selected {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		bar.Increment()
+
+		visibility, description := Private, ""
+		if r, ok := st.Repositories[name]; ok {
+			visibility, description = parseVisibility(r.Visibility), r.Description
+		}
+
+		c._info(bar, fmt.Sprintf("Pushing %s", name))
+		url, err := target.ensure(ctx, namespace, targets[name], visibility, description)
+		if err != nil {
+			c._error(bar, fmt.Sprintf("Failed to create %s on %s - %+v", targets[name], account, err))
+			failed++
+			continue
+		}
+
+		opCtx, watchdog, cancel := c.guard(ctx, account)
+		err = watchdog.explain(opCtx, push(opCtx, path.Join(dir, name), url, false))
+		cancel()
+		if err != nil {
+			c._error(bar, fmt.Sprintf("Failed to push %s - %+v", name, err))
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to push %d of %d repositories", failed, len(selected))
+	}
+	return nil
+}
+
+// parseTargetName parses the template for the name of a pushed repository with the fields .Name, .Namespace and .Base of
+// its source, an empty template is {{.Base}}.
+func parseTargetName(name string, text string) (*template.Template, error) {
+	if text == "" {
+		text = defaultTargetName
+	}
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid name template: %+v", err)
+	}
+	return tmpl, nil
+}
+
+// targetName returns the name tmpl gives to the repository with the full name name.
+func targetName(tmpl *template.Template, name string) (string, error) {
+	namespace, base := splitName(name)
+	var sb strings.Builder
+	err := tmpl.Execute(&sb, struct {
+		Name, Namespace, Base string
+	}{name, namespace, base})
+	if err != nil {
+		return "", err
+	}
+
+	// forges do not allow nested names, flatten whatever the template produced
+	target := strings.ReplaceAll(strings.Trim(sb.String(), "/"), "/", "-")
+	if target == "" {
+		return "", fmt.Errorf("name template produced an empty name for %s", name)
+	}
+	return target, nil
+}
+
+// push force pushes all branches and tags of the repository at location to url. With prune, url becomes a mirror of
+// the source the repository was cloned from: only the refs the source still has are pushed, and the branches and tags
+// of url that the source does not have are deleted.
+func push(ctx context.Context, location string, url string, prune bool) error {
+	r, err := git.PlainOpen(location)
+	if err != nil {
+		return fmt.Errorf("failed to open repo: %+v", err)
+	}
+
+	sources, err := pushSources(r)
+	if err != nil {
+		return err
+	}
+
+	remote := git.NewRemote(r.Storer, &config.RemoteConfig{Name: pushRemote, URLs: []string{url}})
+	deletes := make([]config.RefSpec, 0)
+	if prune {
+		deletes, err = pruneSpecs(ctx, r, remote, sources)
+		if err != nil {
+			return err
+		}
+	}
+	if len(sources) == 0 {
+		return fmt.Errorf("repository has no branches")
+	}
+
+	specs := make([]config.RefSpec, 0, len(sources)+len(deletes))
+	for dst, src := range sources {
+		specs = append(specs, config.RefSpec(fmt.Sprintf("+%s:%s", src, dst)))
+	}
+	specs = append(specs, deletes...)
+
+	err = remote.PushContext(ctx, &git.PushOptions{RemoteName: pushRemote, RefSpecs: specs})
+	if err == git.NoErrAlreadyUpToDate {
+		return nil
+	}
+	return err
+}
+
+// pushSources maps the refs of the destination to the refs of a backup clone they are pushed from. The branches of a
+// clone are its remote-tracking branches, local branches only fill in those that have no remote-tracking counterpart.
+func pushSources(r *git.Repository) (map[plumbing.ReferenceName]plumbing.ReferenceName, error) {
+	iter, err := r.References()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list refs: %+v", err)
+	}
+
+	sources := make(map[plumbing.ReferenceName]plumbing.ReferenceName)
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		name := ref.Name()
+		if ref.Type() != plumbing.HashReference {
+			return nil
+		}
+		switch {
+		case name.IsRemote() && strings.HasPrefix(name.String(), "refs/remotes/origin/"):
+			branch := plumbing.NewBranchReferenceName(strings.TrimPrefix(name.String(), "refs/remotes/origin/"))
+			sources[branch] = name
+		case name.IsBranch():
+			if _, ok := sources[name]; !ok {
+				sources[name] = name
+			}
+		case name.IsTag():
+			sources[name] = name
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sources, nil
+}
+
+// pruneSpecs drops the refs from sources that the origin of r no longer has, pulls do not remove them from the
+// clone. It returns the refspecs that delete the branches and tags of the destination that are not in sources.
+func pruneSpecs(ctx context.Context, r *git.Repository, destination *git.Remote, sources map[plumbing.ReferenceName]plumbing.ReferenceName) ([]config.RefSpec, error) {
+	origin, err := r.Remote(git.DefaultRemoteName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the source: %+v", err)
+	}
+	live, err := listRefs(ctx, origin)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the refs of the source: %+v", err)
+	}
+	for dst := range sources {
+		if _, ok := live[dst]; !ok {
+			delete(sources, dst)
+		}
+	}
+
+	existing, err := listRefs(ctx, destination)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the refs of the destination: %+v", err)
+	}
+	deletes := make([]config.RefSpec, 0)
+	for name := range existing {
+		if _, ok := sources[name]; !ok && (name.IsBranch() || name.IsTag()) {
+			deletes = append(deletes, config.RefSpec(":"+name.String()))
+		}
+	}
+	sort.Slice(deletes, func(i, j int) bool {
+		return deletes[i] < deletes[j]
+	})
+	return deletes, nil
+}
+
+// listRefs returns the names of the refs of the remote, an empty repository has none.
+func listRefs(ctx context.Context, remote *git.Remote) (map[plumbing.ReferenceName]struct{}, error) {
+	refs, err := remote.ListContext(ctx, &git.ListOptions{})
+	if err == gittransport.ErrEmptyRemoteRepository {
+		return map[plumbing.ReferenceName]struct{}{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	names := make(map[plumbing.ReferenceName]struct{}, len(refs))
+	for _, ref := range refs {
+		names[ref.Name()] = struct{}{}
+	}
+	return names, nil
+}
@@ -0,0 +1,204 @@
+package backup
+
+import (
+	"context"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+func TestPush(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	upstream := path.Join(dir, "upstream")
+	u, err := git.PlainInit(upstream, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := commit(t, upstream, "first")
+	err = u.Storer.SetReference(plumbing.NewHashReference("refs/heads/feature", first))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = u.CreateTag("v1", first, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backup := path.Join(dir, "root/account/project")
+	err = clone(ctx, upstream, backup, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the clone has no local feature branch, it only exists as a remote-tracking branch
+	latest := commit(t, upstream, "second")
+	err = _pull(ctx, backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := path.Join(dir, "target.git")
+	d, err := git.PlainInit(target, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = push(ctx, backup, target, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[plumbing.ReferenceName]plumbing.Hash{
+		"refs/heads/master":  latest,
+		"refs/heads/feature": first,
+		"refs/tags/v1":       first,
+	}
+	for name, hash := range expected {
+		ref, err := d.Reference(name, false)
+		if err != nil {
+			t.Fatal("expected", name, "to be pushed", err)
+		}
+		if ref.Hash() != hash {
+			t.Fatal(name, "is", ref.Hash(), "expected", hash)
+		}
+	}
+	if _, err := d.Reference("refs/remotes/origin/master", false); err == nil {
+		t.Fatal("remote-tracking branches must not be pushed as is")
+	}
+
+	err = push(ctx, backup, target, false)
+	if err != nil {
+		t.Fatal("pushing again should be a no-op", err)
+	}
+}
+
+func TestPush_prune(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	upstream := path.Join(dir, "upstream")
+	u, err := git.PlainInit(upstream, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := commit(t, upstream, "first")
+	for _, name := range []plumbing.ReferenceName{"refs/heads/feature", "refs/heads/stale"} {
+		if err := u.Storer.SetReference(plumbing.NewHashReference(name, first)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tag := range []string{"v1", "v2"} {
+		if _, err := u.CreateTag(tag, first, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backup := path.Join(dir, "root/account/project")
+	err = clone(ctx, upstream, backup, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := path.Join(dir, "target.git")
+	d, err := git.PlainInit(target, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = push(ctx, backup, target, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the branch and the tag are deleted in the source, the clone still has them after pulling
+	for _, name := range []plumbing.ReferenceName{"refs/heads/stale", "refs/tags/v1"} {
+		if err := u.Storer.RemoveReference(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	latest := commit(t, upstream, "second")
+	err = _pull(ctx, backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a branch that only exists in the destination
+	err = d.Storer.SetReference(plumbing.NewHashReference("refs/heads/extra", first))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = push(ctx, backup, target, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[plumbing.ReferenceName]plumbing.Hash{
+		"refs/heads/master":  latest,
+		"refs/heads/feature": first,
+		"refs/tags/v2":       first,
+	}
+	for name, hash := range expected {
+		ref, err := d.Reference(name, false)
+		if err != nil || ref.Hash() != hash {
+			t.Fatal("expected", name, "at", hash, "got", ref, err)
+		}
+	}
+	for _, name := range []plumbing.ReferenceName{"refs/heads/stale", "refs/tags/v1", "refs/heads/extra"} {
+		if _, err := d.Reference(name, false); err == nil {
+			t.Fatal("expected", name, "to be pruned")
+		}
+	}
+}
+
+// fakeDestination creates the pushed repositories as bare repositories in a directory.
+type fakeDestination struct {
+	fakeClient
+	dir     string
+	created []string
+}
+
+func (d *fakeDestination) ensure(_ context.Context, namespace string, name string, _ Visibility, _ string) (string, error) {
+	d.created = append(d.created, path.Join(namespace, name))
+	location := path.Join(d.dir, namespace, name+".git")
+	_, err := git.PlainInit(location, true)
+	if err == git.ErrRepositoryAlreadyExists {
+		err = nil
+	}
+	return location, err
+}
+
+func TestGoGitBackup_Push(t *testing.T) {
+	dir := t.TempDir()
+	root := path.Join(dir, "root")
+	for _, name := range []string{"g1/proj", "g2/proj"} {
+		_, err := git.PlainInit(path.Join(root, name), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		commit(t, path.Join(root, name), "README")
+	}
+
+	target := &fakeDestination{dir: path.Join(dir, "target")}
+	c := &GoGitBackup{
+		config:   &Config{Repository: root},
+		accounts: map[string]client{"target": target},
+	}
+
+	// both would be pushed to proj, the second overwriting the first
+	err := c.Push(context.Background(), "", nil, "target", "", "")
+	if err == nil || !strings.Contains(err.Error(), "would both be pushed to proj") {
+		t.Fatal("expected a name collision, got", err)
+	}
+	if len(target.created) != 0 {
+		t.Fatal("nothing must be pushed on a collision, created", target.created)
+	}
+
+	err = c.Push(context.Background(), "", nil, "target", "migrated", "{{.Namespace}}/{{.Base}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(target.created, ",") != "migrated/g1-proj,migrated/g2-proj" {
+		t.Fatal("unexpected targets", target.created)
+	}
+}
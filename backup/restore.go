@@ -0,0 +1,422 @@
+package backup
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cheggaaa/pb/v3"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
+)
+
+// Restore recreates the archived repositories found in the dated directories below from in the directory into.
+// Each repository is restored from its latest full bundle followed by all later increments, encrypted archives are
+// decrypted with the given identity file. With names, only the named repositories and everything below them are
+// restored.
+func (c *GoGitBackup) Restore(ctx context.Context, from string, into string, identity string, names []string) error {
+	if from == "" {
+		from = c.config.Archive
+	}
+	if from == "" {
+		return fmt.Errorf("no archive directory configured")
+	}
+	if into == "" {
+		into = c.config.Repository
+	}
+
+	var dec *decrypter
+	if identity != "" {
+		var err error
+		dec, err = newDecrypter(identity)
+		if err != nil {
+			return err
+		}
+	}
+
+	chains, err := archived(from)
+	if err != nil {
+		return err
+	}
+
+	selected := make([]string, 0, len(chains))
+	for name := range chains {
+		if matches(name, names) {
+			selected = append(selected, name)
+		}
+	}
+	sort.Strings(selected)
+
+	bar := pb.ProgressBarTemplate(progressTemplate).New(len(selected)).SetWriter(os.Stdout).Start()
+	defer bar.Finish()
+
+	failed := 0
+	for _, name := range selected {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		bar.Increment()
+
+		c._info(bar, fmt.Sprintf("Restoring %s", name))
+		err := unbundleChain(ctx, chains[name], path.Join(into, name), dec)
+		if err != nil {
+			c._error(bar, fmt.Sprintf("Failed to restore %s - %+v", name, err))
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to restore %d of %d repositories", failed, len(selected))
+	}
+	return nil
+}
+
+// matches reports whether name is one of names or below one of them, an empty list matches everything.
+func matches(name string, names []string) bool {
+	if len(names) == 0 {
+		return true
+	}
+	for _, n := range names {
+		n = strings.Trim(n, "/")
+		if name == n || strings.HasPrefix(name, n+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+type archiveFile struct {
+	path string
+	// sum is the checksum recorded in the manifest, empty if the archive is not listed.
+	sum string
+}
+
+// archived returns the archive files of every repository in the dated directories below from, oldest first.
+func archived(from string) (map[string][]archiveFile, error) {
+	runs, err := os.ReadDir(from)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archives in %s: %+v", from, err)
+	}
+
+	chains := make(map[string][]archiveFile)
+	// ReadDir sorts by name, which is the order of the runs
+	for _, run := range runs {
+		if !run.IsDir() {
+			continue
+		}
+		dir := path.Join(from, run.Name())
+		sums := readManifest(path.Join(dir, manifestFile))
+
+		err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(dir, p)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if name, ok := bundleName(rel); ok {
+				chains[name] = append(chains[name], archiveFile{path: p, sum: sums[rel]})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return chains, nil
+}
+
+// bundleName strips the bundle suffix and an optional encryption suffix from the name of an archive file.
+func bundleName(file string) (string, bool) {
+	for _, suffix := range []string{bundleSuffix, bundleSuffix + ".age", bundleSuffix + ".gpg"} {
+		if strings.HasSuffix(file, suffix) {
+			return strings.TrimSuffix(file, suffix), true
+		}
+	}
+	return "", false
+}
+
+func readManifest(file string) map[string]string {
+	sums := make(map[string]string)
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		log.Debugf("no manifest %s, archives are not verified", file)
+		return sums
+	}
+	for _, line := range strings.Split(string(raw), "\n") {
+		if sum, name, ok := strings.Cut(line, "  "); ok {
+			sums[name] = sum
+		}
+	}
+	return sums
+}
+
+// openedArchive is the decrypted bundle of an archive file.
+type openedArchive struct {
+	*bufio.Reader
+	file  *os.File
+	plain io.Reader
+	hash  hash.Hash
+	sum   string
+}
+
+func (a archiveFile) open(dec *decrypter) (*openedArchive, error) {
+	f, err := os.Open(a.path)
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha256.New()
+	var plain io.Reader = io.TeeReader(f, h)
+	if !strings.HasSuffix(a.path, bundleSuffix) {
+		if dec == nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("%s is encrypted, an identity is required", a.path)
+		}
+		plain, err = dec.decrypt(plain)
+		if err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("failed to decrypt %s: %+v", a.path, err)
+		}
+	}
+
+	return &openedArchive{
+		Reader: bufio.NewReader(plain),
+		file:   f,
+		plain:  plain,
+		hash:   h,
+		sum:    a.sum,
+	}, nil
+}
+
+// verify reads the rest of the archive, so the integrity checks of the encryption run, and compares its checksum
+// with the one of the manifest.
+func (o *openedArchive) verify() error {
+	_, err := io.Copy(io.Discard, o.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %+v", o.file.Name(), err)
+	}
+	if sum := hex.EncodeToString(o.hash.Sum(nil)); o.sum != "" && sum != o.sum {
+		return fmt.Errorf("checksum mismatch for %s", o.file.Name())
+	}
+	return nil
+}
+
+func (o *openedArchive) Close() error {
+	return o.file.Close()
+}
+
+type bundleInfo struct {
+	prerequisites []plumbing.Hash
+	refs          []*plumbing.Reference
+}
+
+// readBundleHeader reads the header of a v2 git bundle, leaving r at the start of the pack.
+func readBundleHeader(r *bufio.Reader) (*bundleInfo, error) {
+	header, err := r.ReadString('\n')
+	if err != nil || header != bundleHeader {
+		return nil, fmt.Errorf("not a v2 git bundle")
+	}
+
+	info := &bundleInfo{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("truncated bundle header")
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return info, nil
+		}
+
+		if strings.HasPrefix(line, "-") {
+			id, _, _ := strings.Cut(line[1:], " ")
+			info.prerequisites = append(info.prerequisites, plumbing.NewHash(id))
+			continue
+		}
+
+		id, name, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("invalid bundle ref %q", line)
+		}
+		info.refs = append(info.refs, plumbing.NewHashReference(plumbing.ReferenceName(name), plumbing.NewHash(id)))
+	}
+}
+
+// unbundleChain restores a repository from the newest full bundle of chain and all increments after it, with the refs
+// of the last one. The repository is built in a staging directory and only moved to target once it is complete.
+func unbundleChain(ctx context.Context, chain []archiveFile, target string, dec *decrypter) error {
+	if _, err := os.Stat(target); err == nil {
+		return fmt.Errorf("%s already exists", target)
+	}
+
+	start, err := fullBundle(chain, dec)
+	if err != nil {
+		return err
+	}
+
+	parent := path.Dir(target)
+	err = os.MkdirAll(parent, 0755)
+	if err != nil {
+		return err
+	}
+	staging, err := os.MkdirTemp(parent, stagingPrefix+path.Base(target)+"-")
+	if err != nil {
+		return err
+	}
+
+	err = func() error {
+		r, err := git.PlainInit(staging, false)
+		if err != nil {
+			return err
+		}
+
+		var refs []*plumbing.Reference
+		for _, a := range chain[start:] {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			refs, err = unbundle(r, a, dec)
+			if err != nil {
+				return err
+			}
+		}
+		err = prune(r, refs)
+		if err != nil {
+			return err
+		}
+		return checkout(r, refs)
+	}()
+	if err == nil {
+		err = os.Rename(staging, target)
+	}
+	if err != nil {
+		_ = os.RemoveAll(staging)
+	}
+	return err
+}
+
+// fullBundle returns the index of the newest bundle in chain that has no prerequisites.
+func fullBundle(chain []archiveFile, dec *decrypter) (int, error) {
+	for i := len(chain) - 1; i >= 0; i-- {
+		o, err := chain[i].open(dec)
+		if err != nil {
+			return 0, err
+		}
+		info, err := readBundleHeader(o.Reader)
+		_ = o.Close()
+		if err != nil {
+			return 0, fmt.Errorf("%s: %+v", chain[i].path, err)
+		}
+		if len(info.prerequisites) == 0 {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("no full bundle found")
+}
+
+// unbundle adds the objects and refs of the bundle to r and returns the refs of the bundle.
+func unbundle(r *git.Repository, a archiveFile, dec *decrypter) ([]*plumbing.Reference, error) {
+	o, err := a.open(dec)
+	if err != nil {
+		return nil, err
+	}
+	defer o.Close()
+
+	info, err := readBundleHeader(o.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %+v", a.path, err)
+	}
+
+	for _, h := range info.prerequisites {
+		if r.Storer.HasEncodedObject(h) != nil {
+			return nil, fmt.Errorf("%s requires %s, which is missing", a.path, h)
+		}
+	}
+
+	err = packfile.UpdateObjectStorage(r.Storer, o.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unpack %s: %+v", a.path, err)
+	}
+	err = o.verify()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ref := range info.refs {
+		if ref.Name() == plumbing.HEAD {
+			continue
+		}
+		err = r.Storer.SetReference(ref)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return info.refs, nil
+}
+
+// prune removes the refs that are missing from refs, the ones of the last bundle. Each bundle lists every ref of the
+// repository, so these are the branches and tags that were deleted after an earlier bundle of the chain.
+func prune(r *git.Repository, refs []*plumbing.Reference) error {
+	keep := make(map[plumbing.ReferenceName]struct{}, len(refs))
+	for _, ref := range refs {
+		keep[ref.Name()] = struct{}{}
+	}
+
+	iter, err := r.References()
+	if err != nil {
+		return err
+	}
+	gone := make([]plumbing.ReferenceName, 0)
+	_ = iter.ForEach(func(ref *plumbing.Reference) error {
+		if _, ok := keep[ref.Name()]; !ok && ref.Type() == plumbing.HashReference {
+			gone = append(gone, ref.Name())
+		}
+		return nil
+	})
+	for _, name := range gone {
+		err = r.Storer.RemoveReference(name)
+		if err != nil {
+			return fmt.Errorf("failed to remove %s: %+v", name, err)
+		}
+	}
+	return nil
+}
+
+// checkout checks out the branch the bundled HEAD pointed to, or HEAD itself if no branch matches.
+func checkout(r *git.Repository, refs []*plumbing.Reference) error {
+	var head *plumbing.Reference
+	for _, ref := range refs {
+		if ref.Name() == plumbing.HEAD {
+			head = ref
+		}
+	}
+	if head == nil {
+		return nil
+	}
+
+	w, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range refs {
+		if ref.Name().IsBranch() && ref.Hash() == head.Hash() {
+			return w.Checkout(&git.CheckoutOptions{Branch: ref.Name(), Force: true})
+		}
+	}
+	return w.Checkout(&git.CheckoutOptions{Hash: head.Hash(), Force: true})
+}
@@ -0,0 +1,66 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Storage configures an S3-compatible object storage such as AWS S3, MinIO or Ceph.
+type S3Storage struct {
+	Endpoint  string `yaml:"endpoint"`
+	Region    string `yaml:"region"`
+	Bucket    string `yaml:"bucket"`
+	AccessKey string `yaml:"access_key"`
+	SecretKey string `yaml:"secret_key"`
+	// Insecure uses plain http instead of https.
+	Insecure bool `yaml:"insecure"`
+	// Prefix is put in front of every object name.
+	Prefix string `yaml:"prefix"`
+}
+
+type s3Storage struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+func newS3Storage(cnf *S3Storage, transport http.RoundTripper) (*s3Storage, error) {
+	client, err := minio.New(cnf.Endpoint, &minio.Options{
+		Creds:     credentials.NewStaticV4(cnf.AccessKey, cnf.SecretKey, ""),
+		Secure:    !cnf.Insecure,
+		Region:    cnf.Region,
+		Transport: transport,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client for %s: %+v", cnf.Endpoint, err)
+	}
+
+	return &s3Storage{
+		client: client,
+		bucket: cnf.Bucket,
+		prefix: cnf.Prefix,
+	}, nil
+}
+
+// upload puts the file into the bucket. Large files are uploaded in parts, and each part is verified by the server
+// through its Content-MD5.
+func (s *s3Storage) upload(ctx context.Context, file string, name string) error {
+	_, err := s.client.FPutObject(ctx, s.bucket, path.Join(s.prefix, name), file, minio.PutObjectOptions{
+		ContentType:    "application/octet-stream",
+		SendContentMd5: true,
+	})
+	return err
+}
+
+func (s *s3Storage) Close() error {
+	return nil
+}
+
+func (s *s3Storage) String() string {
+	return fmt.Sprintf("s3://%s/%s", s.bucket, s.prefix)
+}
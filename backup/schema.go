@@ -0,0 +1,205 @@
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// schemaDraft is the JSON Schema version of the config schema, the one most editors support.
+const schemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// providerArgs describes the first argument of the accounts of each provider and whether it is required.
+var providerArgs = map[Provider]struct {
+	doc      string
+	required bool
+}{
+	GitHub: {"the user name of the token, without it private repositories cannot be cloned", false},
+	GitLab: {"the URL of the GitLab instance, defaults to https://gitlab.com", false},
+	Gitea:  {"the URL of the Gitea instance", true},
+}
+
+// durationPattern matches the durations time.ParseDuration accepts, plain numbers would be read as nanoseconds.
+const durationPattern = `^[-+]?(0|(([0-9]+(\.[0-9]*)?|\.[0-9]+)(ns|us|µs|μs|ms|s|m|h))+)$`
+
+// scalarSchemas are the schemas of the types that are parsed from a string in the config.
+var scalarSchemas = map[reflect.Type]func() schema{
+	reflect.TypeOf(time.Duration(0)): func() schema {
+		return schema{"type": "string", "pattern": durationPattern, "description": "a duration such as 90s, 30m or 2h"}
+	},
+	reflect.TypeOf(ByteSize(0)): func() schema {
+		return schema{"type": []string{"string", "integer"}, "description": "a size such as 1024, 500MB or 1.5GiB"}
+	},
+	reflect.TypeOf(Bandwidth(0)): func() schema {
+		return schema{"type": []string{"string", "integer"}, "description": "a rate such as 500KB or 5MiB/s"}
+	},
+	reflect.TypeOf(Provider(0)): func() schema {
+		return schema{"enum": enum(providerNames), "description": "the provider of the account"}
+	},
+	reflect.TypeOf(Orphaned(0)): func() schema {
+		return schema{"enum": enum(orphanedNames), "description": "what happens to repositories no account lists anymore"}
+	},
+}
+
+// requiredFields are the fields the validation of the config requires regardless of the other fields.
+var requiredFields = map[reflect.Type][]string{
+	reflect.TypeOf(Config{}):  {"repository"},
+	reflect.TypeOf(Account{}): {"name"},
+	reflect.TypeOf(Network{}): {"name", "repositories"},
+	reflect.TypeOf(Mirror{}):  {"source", "destination"},
+}
+
+type schema map[string]interface{}
+
+// Schema returns the JSON Schema of the config, generated from the types of Config and everything it contains.
+func Schema() ([]byte, error) {
+	definitions := make(map[string]schema)
+	root, err := schemaOf(reflect.TypeOf(Config{}), definitions)
+	if err != nil {
+		return nil, err
+	}
+
+	// the root is a definition as well, inline it
+	s := definitions["Config"]
+	delete(definitions, "Config")
+	if root["$ref"] != "#/definitions/Config" {
+		return nil, fmt.Errorf("unexpected schema root %v", root)
+	}
+	s["$schema"] = schemaDraft
+	s["title"] = "gitback config"
+	s["definitions"] = definitions
+	accountSchema(definitions["Account"])
+
+	raw, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(raw, '\n'), nil
+}
+
+// schemaOf returns the schema of t, structs are added to definitions and referenced.
+func schemaOf(t reflect.Type, definitions map[string]schema) (schema, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if scalar, ok := scalarSchemas[t]; ok {
+		return scalar(), nil
+	}
+	if t.Kind() != reflect.Struct && (reflect.PointerTo(t).Implements(unmarshalerType) || reflect.PointerTo(t).Implements(obsoleteUnmarshalerType)) {
+		// a new custom type has to be described above, or the schema would reject its values
+		return nil, fmt.Errorf("no schema for %s, which has its own YAML parser", t)
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		ref := schema{"$ref": "#/definitions/" + t.Name()}
+		if _, ok := definitions[t.Name()]; ok {
+			return ref, nil
+		}
+		s := schema{"type": "object", "additionalProperties": false}
+		definitions[t.Name()] = s
+
+		properties := make(map[string]schema)
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+			if name == "-" || !f.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = strings.ToLower(f.Name)
+			}
+			property, err := schemaOf(f.Type, definitions)
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %+v", t.Name(), f.Name, err)
+			}
+			properties[name] = property
+		}
+		s["properties"] = properties
+		if required, ok := requiredFields[t]; ok {
+			s["required"] = required
+		}
+		return ref, nil
+	case reflect.Slice:
+		items, err := schemaOf(t.Elem(), definitions)
+		if err != nil {
+			return nil, err
+		}
+		return schema{"type": "array", "items": items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("no schema for %s, keys have to be strings", t)
+		}
+		values, err := schemaOf(t.Elem(), definitions)
+		if err != nil {
+			return nil, err
+		}
+		return schema{"type": "object", "additionalProperties": values}, nil
+	case reflect.String:
+		return schema{"type": "string"}, nil
+	case reflect.Bool:
+		return schema{"type": "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return schema{"type": "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return schema{"type": "number"}, nil
+	}
+	return nil, fmt.Errorf("no schema for %s", t)
+}
+
+// accountSchema adds the rules that depend on the provider of an account and the choice of its token source.
+func accountSchema(s schema) {
+	rules := make([]schema, 0)
+	for _, provider := range sortedProviders() {
+		arg := providerArgs[provider]
+		args := schema{"type": "array", "items": []schema{{"type": "string", "description": arg.doc}}}
+		then := schema{"properties": schema{"args": args}}
+		if arg.required {
+			args["minItems"] = 1
+			then["required"] = []string{"args"}
+		}
+		condition := schema{"properties": schema{"provider": schema{"enum": []interface{}{providerNames[provider], int(provider)}}}}
+		if provider != GitHub {
+			// accounts without a provider are GitHub accounts
+			condition["required"] = []string{"provider"}
+		}
+		rules = append(rules, schema{"if": condition, "then": then})
+	}
+
+	sources := make([]schema, 0)
+	for _, field := range []string{"token", "token_file", "token_command", "token_secret"} {
+		sources = append(sources, schema{"required": []string{field}})
+	}
+	rules = append(rules, schema{"oneOf": sources})
+	s["allOf"] = rules
+}
+
+// sortedProviders returns all providers in the order of their legacy numbers.
+func sortedProviders() []Provider {
+	providers := make([]Provider, 0, len(providerNames))
+	for provider := range providerNames {
+		providers = append(providers, provider)
+	}
+	sort.Slice(providers, func(i, j int) bool { return providers[i] < providers[j] })
+	return providers
+}
+
+// enum returns the names and the legacy numbers of an enumeration such as the providers.
+func enum(names interface{}) []interface{} {
+	v := reflect.ValueOf(names)
+	keys := v.MapKeys()
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Int() < keys[j].Int() })
+
+	values := make([]interface{}, 0, 2*len(keys))
+	for _, key := range keys {
+		values = append(values, v.MapIndex(key).String())
+	}
+	for _, key := range keys {
+		values = append(values, int(key.Int()))
+	}
+	return values
+}
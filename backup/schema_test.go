@@ -0,0 +1,79 @@
+package backup
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// unknownScalar has its own parser but no schema.
+type unknownScalar int
+
+func (u *unknownScalar) UnmarshalYAML(func(interface{}) error) error { return nil }
+
+func TestSchema(t *testing.T) {
+	raw, err := Schema()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shipped, err := os.ReadFile("../config.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(shipped) != string(raw) {
+		t.Fatal("config.schema.json is outdated, update it with: gitback config schema > config.schema.json")
+	}
+
+	var s struct {
+		Properties  map[string]interface{} `json:"properties"`
+		Definitions map[string]struct {
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"definitions"`
+	}
+	err = json.Unmarshal(raw, &s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"repository", "accounts", "include", "layout", "handle_orphaned"} {
+		if _, ok := s.Properties[expected]; !ok {
+			t.Fatal("expected the config property", expected)
+		}
+	}
+	for _, expected := range []string{"provider", "token_secret", "quota", "repository", "handle_orphaned"} {
+		if _, ok := s.Definitions["Account"].Properties[expected]; !ok {
+			t.Fatal("expected the account property", expected)
+		}
+	}
+
+	for provider := range providerNames {
+		if _, ok := providerArgs[provider]; !ok {
+			t.Fatal("expected the arguments of", provider, "to be described")
+		}
+	}
+
+	_, err = schemaOf(reflect.TypeOf(struct{ Unknown unknownScalar }{}), make(map[string]schema))
+	if err == nil {
+		t.Fatal("expected types with their own parser to require a schema")
+	}
+}
+
+func TestDurationPattern(t *testing.T) {
+	pattern := regexp.MustCompile(durationPattern)
+	for _, valid := range []string{"0", "90s", "30m", "2h", "1h30m", "1.5h", "500ms", "10us", "-5s", ".5h"} {
+		if _, err := time.ParseDuration(valid); err != nil {
+			t.Fatal("invalid test case", valid)
+		}
+		if !pattern.MatchString(valid) {
+			t.Fatal("expected", valid, "to match")
+		}
+	}
+	for _, invalid := range []string{"", "30", "1.5", "2 hours", "1d", "h", ".h"} {
+		if pattern.MatchString(invalid) {
+			t.Fatal("expected", invalid, "not to match")
+		}
+	}
+}
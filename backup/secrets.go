@@ -0,0 +1,117 @@
+package backup
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envReference is a reference to an environment variable in a token, e.g., ${GITHUB_TOKEN}.
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// secrets resolves the token of every account from the environment, a file, a command or the vault, so the config
+// itself does not have to contain any.
+func (v *validator) secrets(root *yaml.Node, config *Config) {
+	var vault *vault
+	var vaultErr error
+	for i := range config.Accounts {
+		account := &config.Accounts[i]
+		n := node(root, "accounts", i)
+
+		set := 0
+		for _, source := range []string{account.Token, account.TokenFile, account.TokenCommand, account.TokenSecret} {
+			if source != "" {
+				set++
+			}
+		}
+		if set > 1 {
+			v.errorf(n, "account %q: only one of token, token_file, token_command and token_secret can be set", account.Name)
+			continue
+		}
+
+		var err error
+		switch {
+		case account.TokenFile != "":
+			n = node(n, "token_file")
+			account.Token, err = tokenFromFile(account.TokenFile)
+		case account.TokenCommand != "":
+			n = node(n, "token_command")
+			account.Token, err = tokenFromCommand(account.TokenCommand)
+		case account.TokenSecret != "":
+			n = node(n, "token_secret")
+			if vault == nil && vaultErr == nil {
+				if config.Vault == nil || config.Vault.File == "" {
+					vaultErr = fmt.Errorf("no vault file configured")
+				} else {
+					vault, vaultErr = openVault(config.Vault)
+				}
+			}
+			err = vaultErr
+			if err == nil {
+				account.Token, err = vault.get(account.TokenSecret)
+			}
+		default:
+			n = node(n, "token")
+			account.Token, err = expandEnv(account.Token)
+		}
+		if err != nil {
+			v.errorf(n, "account %q: %+v", account.Name, err)
+		}
+	}
+}
+
+// expandEnv replaces every ${NAME} in s with the value of the environment variable, which has to be set.
+func expandEnv(s string) (string, error) {
+	var err error
+	expanded := envReference.ReplaceAllStringFunc(s, func(ref string) string {
+		name := envReference.FindStringSubmatch(ref)[1]
+		value, ok := os.LookupEnv(name)
+		if !ok && err == nil {
+			err = fmt.Errorf("environment variable %s is not set", name)
+		}
+		return value
+	})
+	return expanded, err
+}
+
+func tokenFromFile(file string) (string, error) {
+	raw, err := os.ReadFile(expandHome(file))
+	if err != nil {
+		return "", fmt.Errorf("failed to read token: %+v", err)
+	}
+	token := strings.TrimSpace(string(raw))
+	if token == "" {
+		return "", fmt.Errorf("token file %s is empty", file)
+	}
+	return token, nil
+}
+
+// tokenFromCommand runs command in the shell and returns the first line of its output, like `pass show` prints the
+// password before any other lines. The command can prompt on the terminal, e.g., for the passphrase of a key.
+func tokenFromCommand(command string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("token command failed: %+v", err)
+	}
+	line, _, _ := strings.Cut(string(bytes.TrimLeft(out, "\r\n")), "\n")
+	token := strings.TrimSpace(line)
+	if token == "" {
+		return "", fmt.Errorf("token command printed no token")
+	}
+	return token, nil
+}
@@ -0,0 +1,55 @@
+package backup
+
+import (
+	"os"
+	"path"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfig_secrets(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("token commands are run with sh")
+	}
+	root := t.TempDir()
+	t.Setenv("GITBACK_TEST_TOKEN", "from-env")
+	tokenFile := path.Join(root, "token")
+	err := os.WriteFile(tokenFile, []byte("from-file\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		desc     string
+		account  string
+		expected string
+		err      string
+	}{
+		{"plain", "token: plain", "plain", ""},
+		{"environment", "token: ${GITBACK_TEST_TOKEN}", "from-env", ""},
+		{"missing environment", "token: ${GITBACK_TEST_MISSING}", "", "line 6, column 12: account \"work\": environment variable GITBACK_TEST_MISSING is not set"},
+		{"file", "token_file: " + tokenFile, "from-file", ""},
+		{"missing file", "token_file: " + path.Join(root, "missing"), "", "line 6, column 17: account \"work\": failed to read token"},
+		{"command", "token_command: printf 'from-command\\nlogin-me\\n'", "from-command", ""},
+		{"failing command", "token_command: exit 1", "", "line 6, column 20: account \"work\": token command failed"},
+		{"ambiguous", "token: plain\n    token_file: " + tokenFile, "", "line 3, column 5: account \"work\": only one of token, token_file, token_command and token_secret can be set"},
+	}
+
+	for _, test := range tests {
+		in := "repository: " + root + "\naccounts:\n  - name: work\n    provider: github\n    args: [me]\n    " + test.account + "\n"
+		config, err := LoadConfig([]byte(in))
+		if test.err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+				t.Fatal("failed", test.desc, "got", err, "expected", test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal("failed", test.desc, err)
+		}
+		if config.Accounts[0].Token != test.expected {
+			t.Fatal("failed", test.desc, "got", config.Accounts[0].Token, "expected", test.expected)
+		}
+	}
+}
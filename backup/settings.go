@@ -0,0 +1,89 @@
+package backup
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// settings are the options that apply to the repositories of a single account, the global ones unless the account
+// overrides them.
+type settings struct {
+	// root is the directory the repositories of the account are backed up in.
+	root                string
+	overwriteOnConflict bool
+	handleOrphaned      Orphaned
+}
+
+// settings returns the settings of the named account, or the global ones if no such account is configured.
+func (c *GoGitBackup) settings(account string) settings {
+	s := settings{
+		root:                c.config.Repository,
+		overwriteOnConflict: c.config.OverwriteOnConflict,
+		handleOrphaned:      c.config.HandleOrphaned,
+	}
+	for _, a := range c.config.Accounts {
+		if a.Name != account {
+			continue
+		}
+		if a.Repository != "" {
+			s.root = accountRoot(c.config.Repository, a.Repository)
+		}
+		if a.OverwriteOnConflict != nil {
+			s.overwriteOnConflict = *a.OverwriteOnConflict
+		}
+		if a.HandleOrphaned != nil {
+			s.handleOrphaned = *a.HandleOrphaned
+		}
+	}
+	return s
+}
+
+// accountRoot resolves the repository of an account, relative ones are below the global backup root.
+func accountRoot(root string, repository string) string {
+	if path.IsAbs(repository) || filepath.IsAbs(repository) {
+		return repository
+	}
+	return path.Join(root, repository)
+}
+
+// roots returns the absolute paths of the backup root and of the roots of all accounts outside of it.
+func (c *GoGitBackup) roots() []string {
+	global := absolute(c.config.Repository)
+	roots := []string{global}
+	seen := map[string]struct{}{global: {}}
+	for _, account := range c.config.Accounts {
+		if account.Repository == "" {
+			continue
+		}
+		root := absolute(accountRoot(c.config.Repository, account.Repository))
+		if _, ok := seen[root]; ok || below(root, global) {
+			continue
+		}
+		seen[root] = struct{}{}
+		roots = append(roots, root)
+	}
+	return roots
+}
+
+// relative returns location relative to the backup root, locations outside of it start with ../.
+func (c *GoGitBackup) relative(location string) (string, error) {
+	rel, err := filepath.Rel(absolute(c.config.Repository), absolute(location))
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+func absolute(location string) string {
+	abs, err := filepath.Abs(location)
+	if err != nil {
+		return path.Clean(location)
+	}
+	return filepath.ToSlash(abs)
+}
+
+// below reports whether location is dir or inside of it.
+func below(location string, dir string) bool {
+	return location == dir || strings.HasPrefix(location, strings.TrimSuffix(dir, "/")+"/")
+}
@@ -0,0 +1,80 @@
+package backup
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+)
+
+func TestGoGitBackup_settings(t *testing.T) {
+	root := t.TempDir()
+	external := t.TempDir()
+	keep, remove := IgnoreOrphaned, RemoveOrphaned
+	overwrite := true
+
+	c := &GoGitBackup{config: &Config{
+		Repository:     root,
+		HandleOrphaned: PullOrphaned,
+		Accounts: []Account{
+			{Name: "work", Repository: "work", HandleOrphaned: &keep},
+			{Name: "personal", Repository: external, HandleOrphaned: &remove, OverwriteOnConflict: &overwrite},
+			{Name: "other"},
+		},
+	}}
+
+	tests := []struct {
+		account  string
+		expected settings
+	}{
+		{"work", settings{root: path.Join(root, "work"), handleOrphaned: IgnoreOrphaned}},
+		{"personal", settings{root: external, overwriteOnConflict: true, handleOrphaned: RemoveOrphaned}},
+		{"other", settings{root: root, handleOrphaned: PullOrphaned}},
+		{"unknown", settings{root: root, handleOrphaned: PullOrphaned}},
+	}
+	for _, test := range tests {
+		if s := c.settings(test.account); s != test.expected {
+			t.Fatal("failed", test.account, "got", s, "expected", test.expected)
+		}
+	}
+
+	roots := c.roots()
+	if len(roots) != 2 || roots[0] != absolute(root) || roots[1] != absolute(external) {
+		t.Fatal("got roots", roots)
+	}
+
+	for _, name := range []string{"work/me/gone", "other/recorded", "other/unrecorded"} {
+		if _, err := git.PlainInit(path.Join(root, name), false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := git.PlainInit(path.Join(external, "me/gone"), false); err != nil {
+		t.Fatal(err)
+	}
+	st, err := loadState(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.succeeded("other/recorded", Repository{ProviderName: "work"}, nil)
+
+	orphaned := c.findOrphaned(map[string]struct{}{})
+	if len(orphaned) != 4 {
+		t.Fatal("expected the orphans of all roots, got", orphaned)
+	}
+
+	expected := map[string]Orphaned{
+		path.Join(root, "work/me/gone"):     IgnoreOrphaned,
+		path.Join(root, "other/recorded"):   IgnoreOrphaned,
+		path.Join(root, "other/unrecorded"): PullOrphaned,
+		path.Join(external, "me/gone"):      RemoveOrphaned,
+	}
+	for location, policy := range expected {
+		if _, err := os.Stat(location); err != nil {
+			t.Fatal(err)
+		}
+		if got := c.orphanPolicy(st, location); got != policy {
+			t.Fatal("failed", location, "got", got, "expected", policy)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"golang.org/x/time/rate"
+)
+
+// SFTPStorage configures a remote host that archives are copied to over SFTP.
+type SFTPStorage struct {
+	// Host is the address of the ssh server, the port defaults to 22.
+	Host string `yaml:"host"`
+	User string `yaml:"user"`
+	// KeyFile is the private key used to authenticate, an encrypted key is unlocked with GITBACK_PASSPHRASE.
+	KeyFile string `yaml:"key_file"`
+	// KnownHosts is used to verify the host key, defaults to ~/.ssh/known_hosts.
+	KnownHosts string `yaml:"known_hosts"`
+	// Path is the directory on the remote host the archives are copied to.
+	Path string `yaml:"path"`
+}
+
+const (
+	// partSuffix marks files that are still being transferred, they are renamed once complete.
+	partSuffix = ".part"
+	// sumSuffix marks the checksum of the file a part was started for, a part is only resumed for the same file.
+	sumSuffix = ".sha256"
+	// sftpTimeout bounds connecting to and the handshake with the remote host.
+	sftpTimeout = 30 * time.Second
+)
+
+type sftpStorage struct {
+	cnf      *SFTPStorage
+	limiters []*rate.Limiter
+
+	conn   io.Closer
+	client *sftp.Client
+	// dial opens a connection and starts sftp on it.
+	dial func(ctx context.Context) (io.Closer, *sftp.Client, error)
+}
+
+func newSFTPStorage(cnf *SFTPStorage, limiters []*rate.Limiter) (*sftpStorage, error) {
+	if cnf.Host == "" || cnf.KeyFile == "" {
+		return nil, fmt.Errorf("sftp storage needs a host and a key_file")
+	}
+	s := &sftpStorage{cnf: cnf, limiters: limiters}
+	s.dial = s.dialSSH
+	return s, nil
+}
+
+// connect opens the connection on first use, so commands that never upload do not need the remote host, and again
+// after a failed upload dropped it.
+func (s *sftpStorage) connect(ctx context.Context) error {
+	if s.client != nil {
+		return nil
+	}
+	conn, client, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	s.client = client
+	return nil
+}
+
+// dialSSH connects to the remote host and starts sftp on the connection.
+func (s *sftpStorage) dialSSH(ctx context.Context) (io.Closer, *sftp.Client, error) {
+	key, err := os.ReadFile(expandHome(s.cnf.KeyFile))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read key %s: %+v", s.cnf.KeyFile, err)
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(os.Getenv(passphraseEnv)))
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse key %s: %+v", s.cnf.KeyFile, err)
+	}
+
+	knownHosts := s.cnf.KnownHosts
+	if knownHosts == "" {
+		knownHosts = "~/.ssh/known_hosts"
+	}
+	hostKeys, err := knownhosts.New(expandHome(knownHosts))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read known hosts %s: %+v", knownHosts, err)
+	}
+
+	host := s.cnf.Host
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, "22")
+	}
+
+	dialer := net.Dialer{Timeout: sftpTimeout}
+	raw, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to %s: %+v", host, err)
+	}
+	// a host that accepts the connection but never answers must not hang the run either
+	_ = raw.SetDeadline(time.Now().Add(sftpTimeout))
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			_ = raw.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+	c, chans, reqs, err := ssh.NewClientConn(raw, host, &ssh.ClientConfig{
+		User:            s.cnf.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeys,
+	})
+	close(done)
+	<-stopped
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		_ = raw.Close()
+		return nil, nil, fmt.Errorf("failed to connect to %s: %+v", host, err)
+	}
+	conn := ssh.NewClient(c, chans, reqs)
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, fmt.Errorf("failed to start sftp on %s: %+v", host, err)
+	}
+	_ = raw.SetDeadline(time.Time{})
+	return conn, client, nil
+}
+
+// upload copies the file to a temporary file next to its destination and renames it once complete. If a previous
+// attempt at the same file left a partial file behind, the transfer is resumed where it stopped.
+func (s *sftpStorage) upload(ctx context.Context, file string, name string) error {
+	err := s.connect(ctx)
+	if err != nil {
+		return err
+	}
+	err = s.transfer(ctx, file, name)
+	if err != nil {
+		// the connection may be dead, so the retry reconnects and resumes from the part instead of failing on it again
+		_ = s.Close()
+	}
+	return err
+}
+
+func (s *sftpStorage) transfer(ctx context.Context, file string, name string) error {
+	local, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer local.Close()
+
+	info, err := local.Stat()
+	if err != nil {
+		return err
+	}
+	hash := sha256.New()
+	_, err = io.Copy(hash, local)
+	if err != nil {
+		return err
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+
+	remote := path.Join(s.cnf.Path, name)
+	part := remote + partSuffix
+	err = s.client.MkdirAll(path.Dir(remote))
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %+v", path.Dir(remote), err)
+	}
+
+	var offset int64
+	if fi, err := s.client.Stat(part); err == nil && fi.Size() <= info.Size() && s.read(part+sumSuffix) == sum {
+		offset = fi.Size()
+		log.Debugf("resuming upload of %s at %d bytes", remote, offset)
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE
+	if offset == 0 {
+		flags |= os.O_TRUNC
+		// a stale or foreign part is started over, and the checksum is written before any of the new part
+		err = s.write(part+sumSuffix, sum)
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %+v", part+sumSuffix, err)
+		}
+	}
+	f, err := s.client.OpenFile(part, flags)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %+v", part, err)
+	}
+
+	_, err = f.Seek(offset, io.SeekStart)
+	if err == nil {
+		_, err = local.Seek(offset, io.SeekStart)
+	}
+	if err == nil {
+		body := &throttledBody{ReadCloser: io.NopCloser(&contextReader{ctx: ctx, r: local}), ctx: ctx, limiters: s.limiters}
+		_, err = io.Copy(f, body)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %+v", remote, err)
+	}
+
+	err = s.client.PosixRename(part, remote)
+	if err != nil {
+		// servers without the posix-rename extension can not replace existing files
+		_ = s.client.Remove(remote)
+		err = s.client.Rename(part, remote)
+	}
+	if err != nil {
+		return err
+	}
+	_ = s.client.Remove(part + sumSuffix)
+	return nil
+}
+
+// read returns the content of a small remote file, or nothing if it cannot be read.
+func (s *sftpStorage) read(name string) string {
+	f, err := s.client.Open(name)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	content, err := io.ReadAll(io.LimitReader(f, 1024))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
+
+// write replaces the content of a small remote file.
+func (s *sftpStorage) write(name string, content string) error {
+	f, err := s.client.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write([]byte(content + "\n"))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (s *sftpStorage) Close() error {
+	if s.client == nil {
+		return nil
+	}
+	err := s.client.Close()
+	if s.conn != nil {
+		err = s.conn.Close()
+	}
+	s.client = nil
+	s.conn = nil
+	return err
+}
+
+func (s *sftpStorage) String() string {
+	return fmt.Sprintf("sftp://%s@%s%s", s.cnf.User, s.cnf.Host, s.cnf.Path)
+}
+
+// contextReader stops reading once its context is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// expandHome replaces a leading ~ with the home directory of the user.
+func expandHome(p string) string {
+	if p != "~" && !strings.HasPrefix(p, "~/") {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return p
+	}
+	return filepath.Join(home, p[1:])
+}
@@ -0,0 +1,175 @@
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/pkg/sftp"
+)
+
+// memConn is the client end of a connection to an in-memory SFTP server. Closing it closes both directions, and it
+// breaks once more than limit bytes were sent if limit is positive.
+type memConn struct {
+	toServer, toClient *io.PipeWriter
+	limit, sent        int64
+}
+
+func (c *memConn) Write(p []byte) (int, error) {
+	if c.limit > 0 && c.sent+int64(len(p)) > c.limit {
+		_ = c.Close()
+		return 0, io.ErrClosedPipe
+	}
+	c.sent += int64(len(p))
+	return c.toServer.Write(p)
+}
+
+func (c *memConn) Close() error {
+	_ = c.toClient.Close()
+	return c.toServer.Close()
+}
+
+// memWriter hides that the files of the in-memory server stop accepting writes after a connection broke while they
+// were open, which real servers do not do.
+type memWriter struct {
+	sftp.FileWriter
+}
+
+func (w memWriter) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	f, err := w.FileWriter.Filewrite(r)
+	return struct{ io.WriterAt }{f}, err
+}
+
+// memSFTP returns a connected storage whose connections all go to the same in-memory SFTP server. The first
+// connections break after the given limits, the returned slice holds every connection made so far.
+func memSFTP(t *testing.T, limits ...int64) (*sftpStorage, *[]*memConn) {
+	handlers := sftp.InMemHandler()
+	handlers.FilePut = memWriter{handlers.FilePut}
+	conns := make([]*memConn, 0)
+	s := &sftpStorage{cnf: &SFTPStorage{Path: "/backup"}}
+	s.dial = func(context.Context) (io.Closer, *sftp.Client, error) {
+		toServer, fromClient := io.Pipe()
+		toClient, fromServer := io.Pipe()
+		server := sftp.NewRequestServer(struct {
+			io.Reader
+			io.WriteCloser
+		}{toServer, fromServer}, handlers)
+		go func() { _ = server.Serve() }()
+
+		conn := &memConn{toServer: fromClient, toClient: fromServer}
+		if len(conns) < len(limits) {
+			conn.limit = limits[len(conns)]
+		}
+		conns = append(conns, conn)
+		client, err := sftp.NewClientPipe(toClient, conn)
+		return conn, client, err
+	}
+	if err := s.connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+	return s, &conns
+}
+
+// remote returns the content of the remote file, or an error if it does not exist.
+func remote(s *sftpStorage, name string) (string, error) {
+	f, err := s.client.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	content, err := io.ReadAll(f)
+	return string(content), err
+}
+
+func TestSFTPStorage_upload(t *testing.T) {
+	file := path.Join(t.TempDir(), "project.bundle")
+	content := "the complete content of the bundle"
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte(content))
+
+	tests := []struct {
+		desc     string
+		part     string
+		sum      string
+		expected string
+	}{
+		{"fresh upload", "", "", content},
+		// the transferred part is kept, a differing one shows that only the rest was uploaded
+		{"resumes a part of the same file", "THE COMPLETE", hex.EncodeToString(sum[:]), "THE COMPLETE content of the bundle"},
+		{"starts over a part of another file", "THE COMPLETE", "0123", content},
+		{"starts over a part without checksum", "THE COMPLETE", "", content},
+		{"starts over a part longer than the file", content + " and more", hex.EncodeToString(sum[:]), content},
+	}
+
+	for _, test := range tests {
+		s, _ := memSFTP(t)
+		part := "/backup/run/project.bundle" + partSuffix
+		if test.part != "" {
+			if err := s.client.MkdirAll("/backup/run"); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.write(part, test.part); err != nil {
+				t.Fatal(err)
+			}
+			// write appends a newline, the part has to be exactly what was transferred
+			if err := s.client.Truncate(part, int64(len(test.part))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if test.sum != "" {
+			if err := s.write(part+sumSuffix, test.sum); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		err := s.upload(context.Background(), file, "run/project.bundle")
+		if err != nil {
+			t.Fatal("failed", test.desc, err)
+		}
+		uploaded, err := remote(s, "/backup/run/project.bundle")
+		if err != nil || uploaded != test.expected {
+			t.Fatal("failed", test.desc, "got", uploaded, err)
+		}
+		for _, leftover := range []string{part, part + sumSuffix} {
+			if _, err := s.client.Stat(leftover); err == nil {
+				t.Fatal("failed", test.desc, leftover, "was left behind")
+			}
+		}
+	}
+}
+
+func TestSFTPStorage_upload_reconnect(t *testing.T) {
+	file := path.Join(t.TempDir(), "project.bundle")
+	content := make([]byte, 1<<20)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	if err := os.WriteFile(file, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first connection breaks in the middle of the upload
+	s, conns := memSFTP(t, 300<<10)
+	err := uploadRetry(context.Background(), s, file, "run/project.bundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*conns) != 2 {
+		t.Fatal("expected the retry to reconnect once, got", len(*conns), "connections")
+	}
+	if sent := (*conns)[1].sent; sent >= int64(len(content)) {
+		t.Fatal("expected the retry to resume from the part, it sent", sent, "bytes")
+	}
+	uploaded, err := remote(s, "/backup/run/project.bundle")
+	if err != nil || uploaded != string(content) {
+		t.Fatal("the resumed upload differs from the file", err)
+	}
+}
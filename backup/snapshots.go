@@ -0,0 +1,259 @@
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// Snapshots configures the generations recorded after each successful backup run and how many of them are kept.
+// Without any keep rule, all snapshots are kept.
+type Snapshots struct {
+	Enabled     bool `yaml:"enabled"`
+	KeepDaily   int  `yaml:"keep_daily"`
+	KeepWeekly  int  `yaml:"keep_weekly"`
+	KeepMonthly int  `yaml:"keep_monthly"`
+}
+
+const (
+	// snapshotDir holds one manifest per snapshot in the backup root.
+	snapshotDir    = ".gitback-snapshots"
+	snapshotLayout = "20060102T150405Z"
+	// internalRefs are refs written by gitback itself, they are neither archived nor recorded as fetched.
+	internalRefs = "refs/gitback/"
+	// snapshotRefs pin the objects of each snapshot, so they survive upstream rewrites.
+	snapshotRefs = internalRefs + "snapshots/"
+)
+
+// snapshot is a generation of the backup: the ref tips of every repository at the end of a run.
+type snapshot struct {
+	ID           string                       `json:"id"`
+	Created      time.Time                    `json:"created"`
+	Repositories map[string]map[string]string `json:"repositories"`
+}
+
+// snapshot records a new generation of the given repositories. The ref tips are stored in a manifest and as refs
+// below refs/gitback/snapshots/<id>/ in each repository.
+func (c *GoGitBackup) snapshot(names []string) (*snapshot, error) {
+	now := time.Now().UTC()
+	s := &snapshot{
+		ID:           now.Format(snapshotLayout),
+		Created:      now,
+		Repositories: make(map[string]map[string]string),
+	}
+
+	for _, name := range names {
+		location := path.Join(c.config.Repository, name)
+		r, err := git.PlainOpen(location)
+		if err != nil {
+			log.Debugf("skipping %s in snapshot: %+v", name, err)
+			continue
+		}
+
+		tips, err := refTips(location)
+		if err != nil {
+			return nil, err
+		}
+		for ref, tip := range tips {
+			pin := plumbing.ReferenceName(snapshotRefs + s.ID + "/" + strings.TrimPrefix(ref, "refs/"))
+			err = r.Storer.SetReference(plumbing.NewHashReference(pin, plumbing.NewHash(tip)))
+			if err != nil {
+				return nil, fmt.Errorf("failed to pin %s in %s: %+v", ref, name, err)
+			}
+		}
+		s.Repositories[name] = tips
+	}
+	return s, c.writeSnapshot(s)
+}
+
+// writeSnapshot writes the manifest of the snapshot.
+func (c *GoGitBackup) writeSnapshot(s *snapshot) error {
+	bytes, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir := path.Join(c.config.Repository, snapshotDir)
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path.Join(dir, s.ID+".json"), bytes, 0644)
+}
+
+// moveSnapshots renames the repositories in all manifests after they were moved, moves maps the previous location
+// of each repository to its current one. Otherwise, pruning could not find the moved repositories to unpin them.
+func (c *GoGitBackup) moveSnapshots(moves map[string]string) error {
+	snapshots, err := c.snapshots()
+	if err != nil {
+		return err
+	}
+	for _, s := range snapshots {
+		changed := false
+		for from, to := range moves {
+			if tips, ok := s.Repositories[from]; ok {
+				delete(s.Repositories, from)
+				s.Repositories[to] = tips
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+		err = c.writeSnapshot(s)
+		if err != nil {
+			return fmt.Errorf("failed to update snapshot %s: %+v", s.ID, err)
+		}
+	}
+	return nil
+}
+
+// snapshots returns all recorded snapshots, oldest first.
+func (c *GoGitBackup) snapshots() ([]*snapshot, error) {
+	dir := path.Join(c.config.Repository, snapshotDir)
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]*snapshot, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		bytes, err := os.ReadFile(path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var s snapshot
+		err = json.Unmarshal(bytes, &s)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse snapshot %s: %+v", e.Name(), err)
+		}
+		snapshots = append(snapshots, &s)
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Created.Before(snapshots[j].Created)
+	})
+	return snapshots, nil
+}
+
+// ListSnapshots prints all recorded snapshots.
+func (c *GoGitBackup) ListSnapshots() error {
+	snapshots, err := c.snapshots()
+	if err != nil {
+		return err
+	}
+
+	const TableFormat = "| %20.20s\t| %30.30s\t| %12.12s\t|\n"
+
+	fmt.Printf("Found %d snapshots:\n", len(snapshots))
+	fmt.Printf(TableFormat, "ID", "Created", "Repositories")
+	for _, s := range snapshots {
+		fmt.Printf(TableFormat, s.ID, s.Created.Local().Format(time.RFC1123), fmt.Sprint(len(s.Repositories)))
+	}
+	return nil
+}
+
+// PruneSnapshots removes all snapshots that are not kept by the retention policy.
+func (c *GoGitBackup) PruneSnapshots() error {
+	if c.config.Snapshots == nil {
+		return nil
+	}
+
+	snapshots, err := c.snapshots()
+	if err != nil {
+		return err
+	}
+
+	keep := retain(snapshots, c.config.Snapshots)
+	for _, s := range snapshots {
+		if keep[s.ID] {
+			continue
+		}
+		err = c.dropSnapshot(s)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Pruned snapshot %s\n", s.ID)
+	}
+	return nil
+}
+
+// retain returns the ids of the snapshots kept by the policy: the newest snapshot of each of the last KeepDaily days,
+// KeepWeekly weeks and KeepMonthly months that have a snapshot.
+func retain(snapshots []*snapshot, policy *Snapshots) map[string]bool {
+	keep := make(map[string]bool)
+	if policy.KeepDaily <= 0 && policy.KeepWeekly <= 0 && policy.KeepMonthly <= 0 {
+		for _, s := range snapshots {
+			keep[s.ID] = true
+		}
+		return keep
+	}
+
+	rules := []struct {
+		count  int
+		bucket func(t time.Time) string
+	}{
+		{policy.KeepDaily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{policy.KeepWeekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-%02d", year, week)
+		}},
+		{policy.KeepMonthly, func(t time.Time) string { return t.Format("2006-01") }},
+	}
+
+	for _, rule := range rules {
+		last := ""
+		remaining := rule.count
+		for i := len(snapshots) - 1; i >= 0 && remaining > 0; i-- {
+			bucket := rule.bucket(snapshots[i].Created)
+			if bucket != last {
+				keep[snapshots[i].ID] = true
+				last = bucket
+				remaining--
+			}
+		}
+	}
+	return keep
+}
+
+// dropSnapshot removes the pinned refs of the snapshot from all repositories and deletes its manifest.
+func (c *GoGitBackup) dropSnapshot(s *snapshot) error {
+	prefix := snapshotRefs + s.ID + "/"
+	for name := range s.Repositories {
+		r, err := git.PlainOpen(path.Join(c.config.Repository, name))
+		if err != nil {
+			log.Debugf("%s of snapshot %s is gone: %+v", name, s.ID, err)
+			continue
+		}
+
+		refs, err := r.References()
+		if err != nil {
+			return err
+		}
+		pinned := make([]plumbing.ReferenceName, 0)
+		_ = refs.ForEach(func(ref *plumbing.Reference) error {
+			if strings.HasPrefix(ref.Name().String(), prefix) {
+				pinned = append(pinned, ref.Name())
+			}
+			return nil
+		})
+		for _, ref := range pinned {
+			err = r.Storer.RemoveReference(ref)
+			if err != nil {
+				return fmt.Errorf("failed to remove %s from %s: %+v", ref, name, err)
+			}
+		}
+	}
+	return os.Remove(path.Join(c.config.Repository, snapshotDir, s.ID+".json"))
+}
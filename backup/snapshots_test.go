@@ -0,0 +1,123 @@
+package backup
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+)
+
+func TestRetain(t *testing.T) {
+	start := time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)
+
+	// one snapshot per day for 90 days, plus a second one on the last day
+	snapshots := make([]*snapshot, 0)
+	for i := 0; i < 90; i++ {
+		created := start.AddDate(0, 0, i)
+		snapshots = append(snapshots, &snapshot{ID: created.Format(snapshotLayout), Created: created})
+	}
+	last := start.AddDate(0, 0, 89).Add(time.Hour)
+	snapshots = append(snapshots, &snapshot{ID: last.Format(snapshotLayout), Created: last})
+
+	tests := []struct {
+		desc     string
+		policy   Snapshots
+		expected []string
+	}{
+		{
+			desc:     "no policy keeps everything",
+			policy:   Snapshots{},
+			expected: nil,
+		},
+		{
+			desc:   "daily",
+			policy: Snapshots{KeepDaily: 3},
+			expected: []string{
+				"20240328T020000Z",
+				"20240329T020000Z",
+				"20240330T030000Z",
+			},
+		},
+		{
+			desc:   "daily and monthly",
+			policy: Snapshots{KeepDaily: 1, KeepMonthly: 3},
+			expected: []string{
+				"20240131T020000Z",
+				"20240229T020000Z",
+				"20240330T030000Z",
+			},
+		},
+		{
+			desc:   "weekly",
+			policy: Snapshots{KeepWeekly: 2},
+			expected: []string{
+				"20240324T020000Z",
+				"20240330T030000Z",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		keep := retain(snapshots, &test.policy)
+		if test.expected == nil {
+			if len(keep) != len(snapshots) {
+				t.Fatal("failed", test.desc, "kept", len(keep), "of", len(snapshots))
+			}
+			continue
+		}
+
+		kept := make([]string, 0, len(keep))
+		for id := range keep {
+			kept = append(kept, id)
+		}
+		sort.Strings(kept)
+		if strings.Join(kept, ",") != strings.Join(test.expected, ",") {
+			t.Fatal("failed", test.desc, "got", kept, "expected", test.expected)
+		}
+	}
+}
+
+func TestGoGitBackup_Do_snapshot(t *testing.T) {
+	tests := []struct {
+		desc      string
+		failing   bool
+		snapshots int
+	}{
+		{"successful run", false, 1},
+		{"failed repository", true, 0},
+	}
+
+	for _, test := range tests {
+		dir := t.TempDir()
+		upstream := path.Join(dir, "upstream")
+		if _, err := git.PlainInit(upstream, false); err != nil {
+			t.Fatal(err)
+		}
+		commit(t, upstream, "first")
+
+		repos := []Repository{{Name: "me/a", CloneUrl: upstream, ProviderName: "github"}}
+		if test.failing {
+			repos = append(repos, Repository{Name: "me/b", CloneUrl: path.Join(dir, "missing"), ProviderName: "github"})
+		}
+		c := &GoGitBackup{
+			config:  &Config{Repository: path.Join(dir, "root"), Snapshots: &Snapshots{Enabled: true}},
+			clients: []client{&fakeClient{account: Account{Name: "github", Token: "valid"}, repos: repos}},
+		}
+		err := c.Do(context.Background(), false)
+		if err != nil {
+			t.Fatal("failed", test.desc, err)
+		}
+
+		snapshots, err := c.snapshots()
+		if err != nil {
+			t.Fatal("failed", test.desc, err)
+		}
+		if len(snapshots) != test.snapshots {
+			t.Fatal("failed", test.desc, "got", len(snapshots), "snapshots, expected", test.snapshots)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// stateFile is the name of the file in the backup root that records the progress of the backup runs.
+const stateFile = ".gitback-state.json"
+
+type repoState struct {
+	Account     string            `json:"account"`
+	Name        string            `json:"name,omitempty"`
+	Visibility  string            `json:"visibility,omitempty"`
+	Description string            `json:"description,omitempty"`
+	LastSuccess time.Time         `json:"last_success"`
+	LastError   string            `json:"last_error,omitempty"`
+	LastErrorAt time.Time         `json:"last_error_at"`
+	Refs        map[string]string `json:"refs,omitempty"`
+	// Bundled are the ref tips of the last archived bundle, incremental bundles in the same archive directory,
+	// BundledIn, build on top of them.
+	Bundled   map[string]string `json:"bundled,omitempty"`
+	BundledIn string            `json:"bundled_in,omitempty"`
+	// Uploaded is the content checksum of the last bundle uploaded to each storage target.
+	Uploaded map[string]string `json:"uploaded,omitempty"`
+}
+
+// state is the persisted progress of the current (or last) run, keyed by the location of each repository relative to
+// the backup root.
+type state struct {
+	RunStarted   time.Time             `json:"run_started"`
+	RunFinished  time.Time             `json:"run_finished"`
+	Repositories map[string]*repoState `json:"repositories"`
+
+	file string
+}
+
+func loadState(root string) (*state, error) {
+	s := &state{
+		Repositories: make(map[string]*repoState),
+		file:         path.Join(root, stateFile),
+	}
+
+	bytes, err := os.ReadFile(s.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read state %s: %+v", s.file, err)
+	}
+
+	err = json.Unmarshal(bytes, s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse state %s: %+v", s.file, err)
+	}
+	if s.Repositories == nil {
+		s.Repositories = make(map[string]*repoState)
+	}
+	return s, nil
+}
+
+// save writes the state next to its final location first, so a crash never leaves a truncated state file behind.
+func (s *state) save() error {
+	bytes, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.file + ".tmp"
+	err = os.WriteFile(tmp, bytes, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write state: %+v", err)
+	}
+	return os.Rename(tmp, s.file)
+}
+
+// begin starts a new run, or continues the previous one if resume is set and it was interrupted.
+func (s *state) begin(resume bool) {
+	if resume && !s.RunStarted.IsZero() && s.RunFinished.IsZero() {
+		log.Infof("resuming run started at %s", s.RunStarted)
+		return
+	}
+	s.RunStarted = time.Now().UTC()
+	s.RunFinished = time.Time{}
+}
+
+func (s *state) finish() {
+	s.RunFinished = time.Now().UTC()
+}
+
+// done reports whether the repository at key was completed during the current run.
+func (s *state) done(key string) bool {
+	r, ok := s.Repositories[key]
+	return ok && !r.LastSuccess.Before(s.RunStarted)
+}
+
+// incomplete returns the keys that were not completed during the current run.
+func (s *state) incomplete(keys []string) []string {
+	missing := make([]string, 0)
+	for _, key := range keys {
+		if !s.done(key) {
+			missing = append(missing, key)
+		}
+	}
+	return missing
+}
+
+func (s *state) repo(key string, account string) *repoState {
+	r, ok := s.Repositories[key]
+	if !ok {
+		r = &repoState{}
+		s.Repositories[key] = r
+	}
+	r.Account = account
+	return r
+}
+
+// succeeded records a completed backup of repo, including the metadata needed to recreate it elsewhere.
+func (s *state) succeeded(key string, repo Repository, refs map[string]string) {
+	r := s.repo(key, repo.ProviderName)
+	r.Name = repo.Name
+	r.LastSuccess = time.Now().UTC()
+	r.Refs = refs
+	r.Visibility = repo.Visibility.String()
+	r.Description = repo.Description
+}
+
+func (s *state) failed(key string, account string, err error) {
+	r := s.repo(key, account)
+	r.LastError = err.Error()
+	r.LastErrorAt = time.Now().UTC()
+}
+
+func (s *state) bundled(key string, dir string, tips map[string]string) {
+	r, ok := s.Repositories[key]
+	if !ok {
+		r = &repoState{}
+		s.Repositories[key] = r
+	}
+	r.Bundled = tips
+	r.BundledIn = dir
+}
+
+func (s *state) uploaded(key string, target string, content string) {
+	r, ok := s.Repositories[key]
+	if !ok {
+		r = &repoState{}
+		s.Repositories[key] = r
+	}
+	if r.Uploaded == nil {
+		r.Uploaded = make(map[string]string)
+	}
+	r.Uploaded[target] = content
+}
+
+// refTips returns the commit each reference of the repository at location points to.
+func refTips(location string) (map[string]string, error) {
+	r, err := git.PlainOpen(location)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open repo: %+v", err)
+	}
+
+	refs, err := r.References()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list refs: %+v", err)
+	}
+
+	tips := make(map[string]string)
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference && !strings.HasPrefix(ref.Name().String(), internalRefs) {
+			tips[ref.Name().String()] = ref.Hash().String()
+		}
+		return nil
+	})
+	return tips, err
+}
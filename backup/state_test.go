@@ -0,0 +1,48 @@
+package backup
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestState_resume(t *testing.T) {
+	root := t.TempDir()
+
+	st, err := loadState(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.begin(false)
+	st.succeeded("done", Repository{ProviderName: "account"}, map[string]string{"refs/heads/main": "abc"})
+	st.failed("broken", "account", errors.New("boom"))
+	if err := st.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		desc     string
+		resume   bool
+		finished bool
+		expected []bool
+	}{
+		{"resume interrupted run", true, false, []bool{true, false, false}},
+		{"new run", false, false, []bool{false, false, false}},
+		{"resume finished run", true, true, []bool{false, false, false}},
+	}
+
+	for _, test := range tests {
+		st, err := loadState(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.finished {
+			st.finish()
+		}
+		st.begin(test.resume)
+		for i, key := range []string{"done", "broken", "unknown"} {
+			if st.done(key) != test.expected[i] {
+				t.Fatal("failed", test.desc, "for", key, "got", st.done(key), "expected", test.expected[i])
+			}
+		}
+	}
+}
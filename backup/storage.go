@@ -0,0 +1,176 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+const uploadAttempts = 3
+
+// Storage configures the remote targets that archives are uploaded to after each archive run.
+type Storage struct {
+	S3   *S3Storage   `yaml:"s3"`
+	SFTP *SFTPStorage `yaml:"sftp"`
+}
+
+// storage is a remote target for archives.
+type storage interface {
+	// upload copies the local file to name, a slash separated path relative to the target.
+	upload(ctx context.Context, file string, name string) error
+	// String identifies the target, e.g., in the state file.
+	String() string
+	Close() error
+}
+
+func (c *GoGitBackup) newStorages(cnf *Storage) ([]storage, error) {
+	storages := make([]storage, 0)
+	if cnf == nil {
+		return storages, nil
+	}
+
+	if cnf.S3 != nil {
+		s, err := newS3Storage(cnf.S3, &transport{base: http.DefaultTransport, limiters: c.limiters("")})
+		if err != nil {
+			return nil, err
+		}
+		storages = append(storages, s)
+	}
+
+	if cnf.SFTP != nil {
+		s, err := newSFTPStorage(cnf.SFTP, c.limiters(""))
+		if err != nil {
+			return nil, err
+		}
+		storages = append(storages, s)
+	}
+	return storages, nil
+}
+
+// upload copies the bundles written by an archive run in dir to all storage targets, below the prefix of the account
+// each repository belongs to. Bundles whose content was already uploaded to a target are skipped. Each account
+// prefix gets a manifest of the bundles uploaded in this run, and the manifest of the whole run is uploaded next to
+// the account prefixes.
+func (c *GoGitBackup) upload(ctx context.Context, st *state, dir string, written map[string]*bundleFile) error {
+	failed := 0
+	for _, s := range c.storages {
+		n, err := c.uploadTo(ctx, s, st, dir, written)
+		if err != nil {
+			return err
+		}
+		failed += n
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d uploads failed", failed)
+	}
+	return nil
+}
+
+// uploadTo uploads the bundles and their manifests to a single storage target and closes it afterwards. It returns the
+// number of failed uploads.
+func (c *GoGitBackup) uploadTo(ctx context.Context, s storage, st *state, dir string, written map[string]*bundleFile) (int, error) {
+	defer s.Close()
+	run := path.Base(dir)
+	failed := 0
+
+	manifests := make(map[string]map[string]string)
+	for name, b := range written {
+		if ctx.Err() != nil {
+			return failed, ctx.Err()
+		}
+
+		rel, err := filepath.Rel(dir, b.file)
+		if err != nil {
+			return failed, err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if st.Repositories[name].Uploaded[s.String()] == b.content {
+			log.Debugf("%s is unchanged on %s, skipping", name, s)
+			continue
+		}
+
+		prefix := c.accountPrefix(st, name)
+		err = uploadRetry(ctx, s, b.file, path.Join(prefix, run, rel))
+		if err != nil {
+			log.Errorf("failed to upload %s to %s: %+v", name, s, err)
+			failed++
+			continue
+		}
+		st.uploaded(name, s.String(), b.content)
+
+		if _, ok := manifests[prefix]; !ok {
+			manifests[prefix] = make(map[string]string)
+		}
+		manifests[prefix][rel] = b.sum
+	}
+
+	for prefix, sums := range manifests {
+		if prefix == "" {
+			// bundles without an account share the location of the run manifest, which lists them as well
+			continue
+		}
+		err := uploadManifest(ctx, s, path.Join(prefix, run, manifestFile), sums)
+		if err != nil {
+			log.Errorf("failed to upload manifest to %s: %+v", s, err)
+			failed++
+		}
+	}
+
+	if ctx.Err() != nil {
+		return failed, ctx.Err()
+	}
+	err := uploadRetry(ctx, s, path.Join(dir, manifestFile), path.Join(run, manifestFile))
+	if err != nil {
+		log.Errorf("failed to upload the manifest of %s to %s: %+v", run, s, err)
+		failed++
+	}
+	return failed, nil
+}
+
+// uploadRetry retries failed uploads, targets that support it resume where the previous attempt stopped.
+func uploadRetry(ctx context.Context, s storage, file string, name string) error {
+	var err error
+	for attempt := 1; attempt <= uploadAttempts; attempt++ {
+		err = s.upload(ctx, file, name)
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		log.Debugf("upload of %s to %s failed (attempt %d): %+v", name, s, attempt, err)
+	}
+	return err
+}
+
+func uploadManifest(ctx context.Context, s storage, name string, sums map[string]string) error {
+	f, err := os.CreateTemp("", "gitback-manifest-")
+	if err != nil {
+		return err
+	}
+	_ = f.Close()
+	defer os.Remove(f.Name())
+
+	err = writeManifest(f.Name(), sums)
+	if err != nil {
+		return err
+	}
+	return uploadRetry(ctx, s, f.Name(), name)
+}
+
+// accountPrefix returns the remote prefix of the account the repository name was backed up from, which is the
+// configured prefix of the account or its name.
+func (c *GoGitBackup) accountPrefix(st *state, name string) string {
+	r, ok := st.Repositories[name]
+	if !ok || r.Account == "" {
+		return ""
+	}
+	for _, account := range c.config.Accounts {
+		if account.Name == r.Account && account.Prefix != "" {
+			return account.Prefix
+		}
+	}
+	return r.Account
+}
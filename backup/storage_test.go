@@ -0,0 +1,157 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// fakeStorage keeps the uploaded files in memory, uploads fail as long as failures is positive.
+type fakeStorage struct {
+	files    map[string][]byte
+	failures int
+	attempts int
+	closed   int
+}
+
+func (s *fakeStorage) upload(_ context.Context, file string, name string) error {
+	s.attempts++
+	if s.failures > 0 {
+		s.failures--
+		return fmt.Errorf("connection reset")
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if s.files == nil {
+		s.files = make(map[string][]byte)
+	}
+	s.files[name] = content
+	return nil
+}
+
+func (s *fakeStorage) String() string { return "fake://" }
+
+func (s *fakeStorage) Close() error {
+	s.closed++
+	return nil
+}
+
+func TestGoGitBackup_upload(t *testing.T) {
+	root := t.TempDir()
+	dir := path.Join(root, "archive", "2024-01-31T02-00-00Z")
+	written := make(map[string]*bundleFile)
+	checksums := make(map[string]string)
+	for _, name := range []string{"me/a", "me/b", "group/c", "local/d"} {
+		file := path.Join(dir, name+bundleSuffix)
+		if err := os.MkdirAll(path.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		written[name] = &bundleFile{file: file, sum: "sum-" + name, content: "content-" + name}
+		checksums[name+bundleSuffix] = "sum-" + name
+	}
+	if err := writeManifest(path.Join(dir, manifestFile), checksums); err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := loadState(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.succeeded("me/a", Repository{Name: "me/a", ProviderName: "github"}, nil)
+	st.succeeded("me/b", Repository{Name: "me/b", ProviderName: "github"}, nil)
+	st.succeeded("group/c", Repository{Name: "group/c", ProviderName: "work"}, nil)
+	// archive runs record every bundle, also those of repositories without an account
+	st.bundled("local/d", path.Join(root, "archive"), nil)
+	// b was uploaded with the same content before
+	st.uploaded("me/b", "fake://", "content-me/b")
+
+	s := &fakeStorage{}
+	c := &GoGitBackup{
+		config:   &Config{Repository: root, Accounts: []Account{{Name: "work", Prefix: "office"}}},
+		storages: []storage{s},
+	}
+	err = c.upload(context.Background(), st, dir, written)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := make([]string, 0, len(s.files))
+	for name := range s.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	// local/d has no account, it is uploaded next to the manifest of the whole run
+	expected := []string{
+		"2024-01-31T02-00-00Z/" + manifestFile,
+		"2024-01-31T02-00-00Z/local/d" + bundleSuffix,
+		"github/2024-01-31T02-00-00Z/" + manifestFile,
+		"github/2024-01-31T02-00-00Z/me/a" + bundleSuffix,
+		"office/2024-01-31T02-00-00Z/" + manifestFile,
+		"office/2024-01-31T02-00-00Z/group/c" + bundleSuffix,
+	}
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Fatal("uploaded", names, "expected", expected)
+	}
+
+	manifest := string(s.files["github/2024-01-31T02-00-00Z/"+manifestFile])
+	if !strings.Contains(manifest, "sum-me/a") || strings.Contains(manifest, "me/b") {
+		t.Fatal("expected the manifest to list only the uploaded bundles, got", manifest)
+	}
+	run := string(s.files["2024-01-31T02-00-00Z/"+manifestFile])
+	for name := range written {
+		if !strings.Contains(run, "sum-"+name) {
+			t.Fatal("expected the manifest of the run to list", name, "got", run)
+		}
+	}
+	if st.Repositories["me/a"].Uploaded["fake://"] != "content-me/a" {
+		t.Fatal("expected the upload to be recorded, got", st.Repositories["me/a"].Uploaded)
+	}
+	if s.closed != 1 {
+		t.Fatal("expected the storage to be closed once, got", s.closed)
+	}
+}
+
+func TestUploadRetry(t *testing.T) {
+	file := path.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		desc     string
+		failures int
+		cancel   bool
+		attempts int
+		fails    bool
+	}{
+		{"first attempt", 0, false, 1, false},
+		{"recovers", uploadAttempts - 1, false, uploadAttempts, false},
+		{"gives up", uploadAttempts, false, uploadAttempts, true},
+		{"stops when cancelled", uploadAttempts, true, 1, true},
+	}
+
+	for _, test := range tests {
+		ctx, cancel := context.WithCancel(context.Background())
+		if test.cancel {
+			cancel()
+		}
+		s := &fakeStorage{failures: test.failures}
+		err := uploadRetry(ctx, s, file, "name")
+		cancel()
+		if (err != nil) != test.fails || s.attempts != test.attempts {
+			t.Fatal("failed", test.desc, "got", s.attempts, "attempts and", err)
+		}
+		if !test.fails && string(s.files["name"]) != "content" {
+			t.Fatal("failed", test.desc, "got", s.files)
+		}
+	}
+}
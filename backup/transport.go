@@ -0,0 +1,238 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	gitclient "github.com/go-git/go-git/v5/plumbing/transport/client"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"golang.org/x/time/rate"
+)
+
+// transport is the http.RoundTripper used by go-git and the provider API clients. Everything that only applies to a
+// single repository operation is looked up in the context of each request.
+type transport struct {
+	base     http.RoundTripper
+	limiters []*rate.Limiter
+}
+
+var installTransport sync.Once
+
+// installGitTransport replaces the http(s) transport of go-git with our own.
+func installGitTransport() {
+	installTransport.Do(func() {
+		git := githttp.NewClient(&http.Client{Transport: &transport{base: http.DefaultTransport}})
+		gitclient.InstallProtocol("https", git)
+		gitclient.InstallProtocol("http", git)
+	})
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	limiters := t.limiters
+	if l, ok := req.Context().Value(throttleKey{}).([]*rate.Limiter); ok {
+		limiters = append(append([]*rate.Limiter{}, limiters...), l...)
+	}
+	if len(limiters) > 0 && req.Body != nil {
+		req = req.Clone(req.Context())
+		req.Body = &throttledBody{ReadCloser: req.Body, ctx: req.Context(), limiters: limiters}
+	}
+
+	w, watched := req.Context().Value(watchdogKey{}).(*watchdog)
+	if watched {
+		w.begin()
+	}
+	res, err := t.base.RoundTrip(req)
+	if err != nil {
+		if watched {
+			w.end()
+		}
+		return nil, err
+	}
+
+	if len(limiters) > 0 {
+		res.Body = &throttledBody{ReadCloser: res.Body, ctx: req.Context(), limiters: limiters}
+	}
+	if watched {
+		res.Body = &watchedBody{ReadCloser: res.Body, watchdog: w}
+	}
+	return res, nil
+}
+
+type throttleKey struct{}
+
+// newLimiter returns a limiter for the given bandwidth, or nil if the bandwidth is unlimited.
+func newLimiter(bandwidth Bandwidth) *rate.Limiter {
+	if bandwidth <= 0 {
+		return nil
+	}
+	burst := int(bandwidth)
+	if burst > 64<<10 {
+		burst = 64 << 10
+	}
+	return rate.NewLimiter(rate.Limit(bandwidth), burst)
+}
+
+// limiters returns the global limiter and the one of the given account, if they are configured.
+func (c *GoGitBackup) limiters(account string) []*rate.Limiter {
+	limiters := make([]*rate.Limiter, 0, 2)
+	if c.throttle != nil {
+		limiters = append(limiters, c.throttle)
+	}
+	if l, ok := c.throttles[account]; ok {
+		limiters = append(limiters, l)
+	}
+	return limiters
+}
+
+// httpClient returns the client that the provider API of the given account should use.
+func (c *GoGitBackup) httpClient(account string) *http.Client {
+	return &http.Client{Transport: &transport{base: http.DefaultTransport, limiters: c.limiters(account)}}
+}
+
+// throttledBody limits reads to the rate of all its limiters.
+type throttledBody struct {
+	io.ReadCloser
+	ctx      context.Context
+	limiters []*rate.Limiter
+}
+
+func (b *throttledBody) Read(p []byte) (int, error) {
+	for _, l := range b.limiters {
+		if len(p) > l.Burst() {
+			p = p[:l.Burst()]
+		}
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	for _, l := range b.limiters {
+		if werr := l.WaitN(b.ctx, n); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	return n, err
+}
+
+type watchdogKey struct{}
+
+// watchdog aborts a repository operation once no bytes were received for the stall timeout. It is only armed while
+// requests are in flight, so local work such as a checkout after the download is never considered a stall.
+type watchdog struct {
+	timeout time.Duration
+	cancel  context.CancelFunc
+	stalled atomic.Bool
+
+	mu       sync.Mutex
+	inflight int
+	timer    *time.Timer
+}
+
+// guard bounds a single repository operation of the given account by the configured timeout, stall detection and
+// bandwidth limits.
+func (c *GoGitBackup) guard(ctx context.Context, account string) (context.Context, *watchdog, context.CancelFunc) {
+	var cancel context.CancelFunc
+	if c.config.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.config.Timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+
+	w := &watchdog{
+		timeout: c.config.StallTimeout,
+		cancel:  cancel,
+	}
+	ctx = context.WithValue(ctx, throttleKey{}, c.limiters(account))
+	return context.WithValue(ctx, watchdogKey{}, w), w, func() {
+		w.stop()
+		cancel()
+	}
+}
+
+func (w *watchdog) begin() {
+	if w.timeout <= 0 {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.inflight++
+	if w.timer == nil {
+		w.timer = time.AfterFunc(w.timeout, func() {
+			w.stalled.Store(true)
+			w.cancel()
+		})
+	} else if w.inflight == 1 {
+		w.timer.Reset(w.timeout)
+	}
+}
+
+func (w *watchdog) touch() {
+	if w.timeout <= 0 {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.inflight > 0 {
+		w.timer.Reset(w.timeout)
+	}
+}
+
+func (w *watchdog) end() {
+	if w.timeout <= 0 {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.inflight--
+	if w.inflight == 0 {
+		w.timer.Stop()
+	}
+}
+
+func (w *watchdog) stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+}
+
+// explain replaces the error of an operation that was aborted by the watchdog or the timeout with the reason.
+func (w *watchdog) explain(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if w.stalled.Load() {
+		return fmt.Errorf("stalled, no data received for %s", w.timeout)
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timed out: %+v", err)
+	}
+	return err
+}
+
+type watchedBody struct {
+	io.ReadCloser
+	watchdog *watchdog
+	once     sync.Once
+}
+
+func (b *watchedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.watchdog.touch()
+	}
+	if err != nil {
+		b.once.Do(b.watchdog.end)
+	}
+	return n, err
+}
+
+func (b *watchedBody) Close() error {
+	b.once.Do(b.watchdog.end)
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,50 @@
+package backup
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTransport_stall(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+
+	c := &GoGitBackup{config: &Config{StallTimeout: 100 * time.Millisecond}}
+	ctx, watchdog, cancel := c.guard(context.Background(), "")
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	client := &http.Client{Transport: &transport{base: http.DefaultTransport}}
+
+	start := time.Now()
+	res, err := client.Do(req)
+	if err == nil {
+		_, err = io.ReadAll(res.Body)
+		_ = res.Body.Close()
+	}
+
+	if err == nil {
+		t.Fatal("expected the stalled request to fail")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("stall was not detected in time")
+	}
+	if err = watchdog.explain(ctx, err); !strings.HasPrefix(err.Error(), "stalled") {
+		t.Fatal("expected a stall, got", err)
+	}
+}
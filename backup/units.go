@@ -0,0 +1,101 @@
+package backup
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ByteSize is an amount of bytes that can be written as e.g. `500MB` or `1.5GiB` in the config.
+type ByteSize int64
+
+// Bandwidth is a rate in bytes per second that can be written as e.g. `5MiB/s` in the config.
+type Bandwidth int64
+
+var units = []struct {
+	suffix string
+	factor float64
+}{
+	// longest suffixes first, so that e.g. KiB is not parsed as B
+	{"KiB", 1 << 10},
+	{"MiB", 1 << 20},
+	{"GiB", 1 << 30},
+	{"TiB", 1 << 40},
+	{"KB", 1e3},
+	{"MB", 1e6},
+	{"GB", 1e9},
+	{"TB", 1e12},
+	{"K", 1 << 10},
+	{"M", 1 << 20},
+	{"G", 1 << 30},
+	{"T", 1 << 40},
+	{"B", 1},
+}
+
+// ParseByteSize parses sizes such as `1024`, `500MB` or `1.5GiB`.
+func ParseByteSize(s string) (ByteSize, error) {
+	value := strings.TrimSpace(s)
+	factor := 1.0
+	for _, unit := range units {
+		if strings.HasSuffix(strings.ToUpper(value), strings.ToUpper(unit.suffix)) {
+			value = strings.TrimSpace(value[:len(value)-len(unit.suffix)])
+			factor = unit.factor
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(value, 64)
+	// the negated comparison also rejects NaN, and sizes that do not fit into an int64
+	if err != nil || n < 0 || !(n*factor < math.MaxInt64) {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return ByteSize(n * factor), nil
+}
+
+func (b ByteSize) String() string {
+	for _, unit := range []struct {
+		suffix string
+		factor ByteSize
+	}{{"TiB", 1 << 40}, {"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10}} {
+		if b >= unit.factor {
+			return fmt.Sprintf("%.1f%s", float64(b)/float64(unit.factor), unit.suffix)
+		}
+	}
+	return fmt.Sprintf("%dB", int64(b))
+}
+
+// ParseBandwidth parses rates such as `5MiB/s` or `500KB`, the `/s` suffix is optional.
+func ParseBandwidth(s string) (Bandwidth, error) {
+	size, err := ParseByteSize(strings.TrimSuffix(strings.TrimSpace(s), "/s"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid bandwidth %q", s)
+	}
+	return Bandwidth(size), nil
+}
+
+func (b *ByteSize) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var raw string
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+	size, err := ParseByteSize(raw)
+	if err != nil {
+		return err
+	}
+	*b = size
+	return nil
+}
+
+func (b *Bandwidth) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var raw string
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+	bandwidth, err := ParseBandwidth(raw)
+	if err != nil {
+		return err
+	}
+	*b = bandwidth
+	return nil
+}
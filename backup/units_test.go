@@ -0,0 +1,77 @@
+package backup
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected ByteSize
+		err      bool
+	}{
+		{in: "1024", expected: 1024},
+		{in: "500B", expected: 500},
+		{in: "500MB", expected: 500e6},
+		{in: "1.5GiB", expected: 1536 << 20},
+		{in: "2 kib", expected: 2048},
+		{in: "10G", expected: 10 << 30},
+		{in: "2TB", expected: 2e12},
+		{in: "1tib", expected: 1 << 40},
+		{in: "3k", expected: 3 << 10},
+		{in: "fast", err: true},
+		{in: "-1MB", err: true},
+		{in: "NaN", err: true},
+		{in: "nanB", err: true},
+		{in: "Inf", err: true},
+		{in: "+InfGB", err: true},
+		{in: "-Inf", err: true},
+		{in: "9223372036854775807", err: true},
+		{in: "8388608TiB", err: true},
+		{in: "1e300GB", err: true},
+		{in: "8388607TiB", expected: 8388607 << 40},
+	}
+
+	for _, test := range tests {
+		size, err := ParseByteSize(test.in)
+		if (err != nil) != test.err {
+			t.Fatal("failed", test.in, "got error", err)
+		}
+		if size != test.expected {
+			t.Fatal("failed", test.in, "got", size, "expected", test.expected)
+		}
+	}
+}
+
+func TestByteSize_String(t *testing.T) {
+	tests := map[ByteSize]string{
+		0:             "0B",
+		1023:          "1023B",
+		1536:          "1.5KiB",
+		5 << 30:       "5.0GiB",
+		ByteSize(1e6): "976.6KiB",
+	}
+	for size, expected := range tests {
+		if size.String() != expected {
+			t.Fatal("failed", int64(size), "got", size.String(), "expected", expected)
+		}
+	}
+}
+
+func TestBandwidth_UnmarshalYAML(t *testing.T) {
+	root := t.TempDir()
+
+	config, err := LoadConfig([]byte("repository: " + root + "\nmax_bandwidth: 5MiB/s\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.MaxBandwidth != 5<<20 {
+		t.Fatal("got", config.MaxBandwidth, "expected", 5<<20)
+	}
+
+	_, err = LoadConfig([]byte("repository: " + root + "\nmax_bandwidth: 5 parsecs\n"))
+	if err == nil || !strings.Contains(err.Error(), "invalid bandwidth") {
+		t.Fatal("expected an error for an invalid bandwidth, got", err)
+	}
+}
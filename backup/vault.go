@@ -0,0 +1,232 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"filippo.io/age"
+	"golang.org/x/term"
+)
+
+// vaultPassphraseEnv holds the passphrase of a vault that is not encrypted with a key file.
+const vaultPassphraseEnv = "GITBACK_VAULT_PASSPHRASE"
+
+// Vault is an encrypted file of named tokens that accounts refer to with token_secret.
+type Vault struct {
+	File string `yaml:"file"`
+	// KeyFile is an age identity, e.g., created with age-keygen, that the vault is encrypted to. Without it, the vault
+	// is encrypted with a passphrase from GITBACK_VAULT_PASSPHRASE or the terminal.
+	KeyFile string `yaml:"key_file"`
+}
+
+// VaultConfig returns the vault section of the config at file, merged with its fragments like LoadConfigFile, without
+// validating the rest of it, so that secrets can be added before the accounts that refer to them are valid.
+func VaultConfig(file string) (*Vault, error) {
+	root, _, err := mergeDocuments(file)
+	if err != nil {
+		return nil, err
+	}
+	var config struct {
+		Vault *Vault `yaml:"vault"`
+	}
+	err = root.Decode(&config)
+	if err != nil {
+		return nil, err
+	}
+	if config.Vault == nil || config.Vault.File == "" {
+		return nil, fmt.Errorf("no vault file configured")
+	}
+	return config.Vault, nil
+}
+
+type vault struct {
+	cnf       *Vault
+	secrets   map[string]string
+	recipient age.Recipient
+	identity  age.Identity
+}
+
+// openVault decrypts the vault, a vault that does not exist yet is empty.
+func openVault(cnf *Vault) (*vault, error) {
+	v := &vault{cnf: cnf, secrets: make(map[string]string)}
+
+	raw, err := os.ReadFile(expandHome(cnf.File))
+	exists := err == nil
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read vault: %+v", err)
+	}
+
+	err = v.keys(exists)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return v, nil
+	}
+
+	r, err := age.Decrypt(bytes.NewReader(raw), v.identity)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt vault %s: %+v", cnf.File, err)
+	}
+	err = json.NewDecoder(r).Decode(&v.secrets)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vault %s: %+v", cnf.File, err)
+	}
+	return v, nil
+}
+
+// keys derives the keys of the vault from the key file or the passphrase. A new vault asks for the passphrase twice.
+func (v *vault) keys(exists bool) error {
+	if v.cnf.KeyFile != "" {
+		raw, err := os.ReadFile(expandHome(v.cnf.KeyFile))
+		if err != nil {
+			return fmt.Errorf("failed to read vault key: %+v", err)
+		}
+		identities, err := age.ParseIdentities(bytes.NewReader(raw))
+		if err != nil {
+			return fmt.Errorf("invalid vault key %s: %+v", v.cnf.KeyFile, err)
+		}
+		identity, ok := identities[0].(*age.X25519Identity)
+		if !ok {
+			return fmt.Errorf("vault key %s is not an X25519 identity", v.cnf.KeyFile)
+		}
+		v.identity, v.recipient = identity, identity.Recipient()
+		return nil
+	}
+
+	passphrase, ok := os.LookupEnv(vaultPassphraseEnv)
+	if !ok {
+		var err error
+		passphrase, err = PromptSecret("Vault passphrase: ")
+		if err != nil {
+			return err
+		}
+		if !exists {
+			confirm, err := PromptSecret("Repeat the passphrase of the new vault: ")
+			if err != nil {
+				return err
+			}
+			if confirm != passphrase {
+				return fmt.Errorf("passphrases do not match")
+			}
+		}
+	}
+	if passphrase == "" {
+		return fmt.Errorf("the vault passphrase is empty")
+	}
+
+	recipient, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		return err
+	}
+	identity, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return err
+	}
+	v.recipient, v.identity = recipient, identity
+	return nil
+}
+
+// save encrypts the vault into a temporary file next to it first, so a failure never destroys the previous vault.
+func (v *vault) save() error {
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, v.recipient)
+	if err != nil {
+		return err
+	}
+	err = json.NewEncoder(w).Encode(v.secrets)
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+
+	file := expandHome(v.cnf.File)
+	tmp := file + ".tmp"
+	err = os.WriteFile(tmp, buf.Bytes(), 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write vault: %+v", err)
+	}
+	return os.Rename(tmp, file)
+}
+
+func (v *vault) get(name string) (string, error) {
+	secret, ok := v.secrets[name]
+	if !ok {
+		return "", fmt.Errorf("secret %q is not in the vault", name)
+	}
+	return secret, nil
+}
+
+// SetSecret stores the secret under name in the vault, replacing any previous value.
+func SetSecret(cnf *Vault, name string, secret string) error {
+	if name == "" || secret == "" {
+		return fmt.Errorf("name and secret must not be empty")
+	}
+	v, err := openVault(cnf)
+	if err != nil {
+		return err
+	}
+	v.secrets[name] = secret
+	return v.save()
+}
+
+// ListSecrets returns the names of all secrets in the vault.
+func ListSecrets(cnf *Vault) ([]string, error) {
+	v, err := openVault(cnf)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(v.secrets))
+	for name := range v.secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// RemoveSecret deletes the secret stored under name from the vault.
+func RemoveSecret(cnf *Vault, name string) error {
+	v, err := openVault(cnf)
+	if err != nil {
+		return err
+	}
+	if _, ok := v.secrets[name]; !ok {
+		return fmt.Errorf("secret %q is not in the vault", name)
+	}
+	delete(v.secrets, name)
+	return v.save()
+}
+
+// stdin reads the secrets piped into gitback. It is shared by all prompts, as it buffers ahead of the line it returns.
+var stdin = bufio.NewReader(os.Stdin)
+
+// PromptSecret asks for a secret on the terminal without echoing it. If stdin is not a terminal, the next line of it
+// is read instead, so that secrets can be piped in.
+func PromptSecret(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := stdin.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		return strings.TrimSpace(line), nil
+	}
+
+	_, _ = fmt.Fprint(os.Stderr, prompt)
+	secret, err := term.ReadPassword(fd)
+	_, _ = fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(secret)), nil
+}
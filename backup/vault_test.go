@@ -0,0 +1,118 @@
+package backup
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"golang.org/x/term"
+)
+
+func TestVault(t *testing.T) {
+	dir := t.TempDir()
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := path.Join(dir, "key.txt")
+	err = os.WriteFile(keyFile, []byte(identity.String()+"\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(vaultPassphraseEnv, "correct horse battery staple")
+	for _, cnf := range []*Vault{
+		{File: path.Join(dir, "key.vault"), KeyFile: keyFile},
+		{File: path.Join(dir, "passphrase.vault")},
+	} {
+		for _, name := range []string{"github", "gitlab"} {
+			err = SetSecret(cnf, name, name+"-token")
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		raw, err := os.ReadFile(cnf.File)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(raw), "github-token") {
+			t.Fatal("the vault must not contain plain tokens")
+		}
+
+		err = RemoveSecret(cnf, "gitlab")
+		if err != nil {
+			t.Fatal(err)
+		}
+		names, err := ListSecrets(cnf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(names, ",") != "github" {
+			t.Fatal("got", names, "expected github")
+		}
+
+		in := "repository: " + dir + "\nvault:\n  file: " + cnf.File + "\n  key_file: " + cnf.KeyFile +
+			"\naccounts:\n  - name: work\n    provider: github\n    args: [me]\n    token_secret: github\n"
+		config, err := LoadConfig([]byte(in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.Accounts[0].Token != "github-token" {
+			t.Fatal("got", config.Accounts[0].Token, "expected github-token")
+		}
+	}
+
+	t.Setenv(vaultPassphraseEnv, "wrong")
+	if _, err := ListSecrets(&Vault{File: path.Join(dir, "passphrase.vault")}); err == nil {
+		t.Fatal("expected a wrong passphrase to fail")
+	}
+}
+
+func TestVaultConfig(t *testing.T) {
+	dir := t.TempDir()
+	main := writeConfig(t, dir, "config.yml", `repository: ROOT
+accounts:
+  - name: work
+    token_secret: work
+`)
+
+	if _, err := VaultConfig(main); err == nil {
+		t.Fatal("expected an error without a vault")
+	}
+
+	// the vault is configured by a fragment
+	writeConfig(t, dir, "conf.d/vault.yml", `vault:
+  file: ROOT/secrets.age
+`)
+	vault, err := VaultConfig(main)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vault.File != path.Join(dir, "secrets.age") {
+		t.Fatal("got", vault.File)
+	}
+}
+
+func TestPromptSecret(t *testing.T) {
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		t.Skip("secrets are read from the terminal")
+	}
+	previous := stdin
+	defer func() { stdin = previous }()
+	stdin = bufio.NewReader(strings.NewReader("passphrase\npassphrase\n"))
+
+	// e.g., the passphrase of a new vault and its confirmation
+	for i := 0; i < 2; i++ {
+		secret, err := PromptSecret("Passphrase: ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if secret != "passphrase" {
+			t.Fatal("prompt", i, "got", secret)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"golang.org/x/term"
+)
+
+// configTemplate is the config written by the wizard.
+const configTemplate = `# Created by gitback init, see the Readme for all other settings, e.g., layout, handle_orphaned, timeouts or
+# archives. The config contains tokens, keep it private.
+
+# repository is the directory all repositories are backed up in.
+repository: {{quote .Repository}}
+
+accounts:
+{{- range .Accounts}}
+  # {{.Repositories}} repositories at the time of gitback init
+  - name: {{quote .Name}}
+    # one of github, gitlab or gitea
+    provider: {{.Provider}}
+    # instead of the token itself, token can refer to an environment variable, e.g., ${GITHUB_TOKEN}, or be replaced by
+    # token_file, token_command or token_secret
+    token: {{quote .Token}}
+{{- if .Arg}}
+    args:
+      # {{.ArgHelp}}
+      - {{quote .Arg}}
+{{- end}}
+{{- end}}
+`
+
+// Wizard creates a config by asking for the backup root and the accounts to back up.
+type Wizard struct {
+	in  *bufio.Reader
+	out io.Writer
+	// secret asks for a token without echoing it.
+	secret func(prompt string) (string, error)
+	// client creates the client that checks an account.
+	client func(account Account) client
+}
+
+// wizardAccount is an account of the config written by the wizard.
+type wizardAccount struct {
+	Name, Provider, Token, Arg, ArgHelp string
+	Repositories                        int
+}
+
+// NewWizard returns a wizard that reads the answers from in and writes the questions to out. Tokens are read without
+// echo if in is a terminal.
+func NewWizard(in io.Reader, out io.Writer) *Wizard {
+	w := &Wizard{
+		in:  bufio.NewReader(in),
+		out: out,
+		client: func(account Account) client {
+			return newClient(account, nil)
+		},
+	}
+	w.secret = func(prompt string) (string, error) {
+		if f, ok := in.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+			return PromptSecret(prompt)
+		}
+		return w.ask(prompt, "")
+	}
+	return w
+}
+
+// Run asks for the settings of the config, checks the token of each account by listing its repositories and returns
+// the commented config. The backup root is created if it does not exist.
+func (w *Wizard) Run(ctx context.Context) ([]byte, error) {
+	root, err := w.ask("Directory to back up into", "backup")
+	if err != nil {
+		return nil, err
+	}
+	root, err = filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	accounts := make([]wizardAccount, 0)
+	names := make(map[string]struct{})
+	for {
+		account, err := w.account(ctx, names)
+		if err != nil {
+			return nil, err
+		}
+		if account != nil {
+			accounts = append(accounts, *account)
+			names[account.Name] = struct{}{}
+		}
+
+		more, err := w.confirm("Add another account?", false)
+		if err != nil {
+			return nil, err
+		}
+		if !more {
+			break
+		}
+	}
+	if len(accounts) == 0 {
+		return nil, fmt.Errorf("no account was added")
+	}
+
+	err = os.MkdirAll(root, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %+v", root, err)
+	}
+
+	var buf bytes.Buffer
+	tmpl := template.Must(template.New("config").Funcs(template.FuncMap{"quote": strconv.Quote}).Parse(configTemplate))
+	err = tmpl.Execute(&buf, struct {
+		Repository string
+		Accounts   []wizardAccount
+	}{root, accounts})
+	if err != nil {
+		return nil, err
+	}
+
+	// the wizard must never write a config that the other commands reject
+	_, err = LoadConfig(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("created an invalid config: %+v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// account asks for a single account until its token works, it returns nil if the user gives up on it.
+func (w *Wizard) account(ctx context.Context, names map[string]struct{}) (*wizardAccount, error) {
+	for {
+		provider, err := w.provider()
+		if err != nil {
+			return nil, err
+		}
+
+		var arg, argHelp, suggestion string
+		switch provider {
+		case GitHub:
+			arg, err = w.required("GitHub user name")
+			suggestion = "github-" + arg
+		case GitLab:
+			arg, err = w.url("GitLab URL", "https://gitlab.com")
+			suggestion = "gitlab"
+		case Gitea:
+			arg, err = w.url("Gitea URL", "")
+			suggestion = "gitea"
+		}
+		if err != nil {
+			return nil, err
+		}
+		argHelp = providerArgs[provider].doc
+		if u, err := url.Parse(arg); err == nil && provider != GitHub {
+			suggestion = u.Host
+		}
+
+		name, err := w.ask("Account name", suggestion)
+		for err == nil {
+			if _, taken := names[name]; !taken && name != "" {
+				break
+			}
+			_, _ = fmt.Fprintf(w.out, "An account named %q exists already.\n", name)
+			name, err = w.ask("Account name", "")
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		token, err := w.secret("Token: ")
+		if err != nil {
+			return nil, err
+		}
+
+		account := Account{Name: name, Provider: provider, Token: token}
+		if arg != "" {
+			account.Args = []string{arg}
+		}
+		repos, err := w.check(ctx, account)
+		if err == nil {
+			_, _ = fmt.Fprintf(w.out, "Found %d repositories that would be backed up%s\n", len(repos), sample(repos))
+			return &wizardAccount{
+				Name:         name,
+				Provider:     provider.String(),
+				Token:        token,
+				Arg:          arg,
+				ArgHelp:      argHelp,
+				Repositories: len(repos),
+			}, nil
+		}
+
+		_, _ = fmt.Fprintf(w.out, "Could not list the repositories of %s: %+v\n", name, err)
+		retry, err := w.confirm("Try again?", true)
+		if err != nil || !retry {
+			return nil, err
+		}
+	}
+}
+
+// check lists the repositories of account with its token.
+func (w *Wizard) check(ctx context.Context, account Account) ([]Repository, error) {
+	cl := w.client(account)
+	if cl == nil {
+		return nil, fmt.Errorf("unknown provider %s", account.Provider)
+	}
+	err := cl.Init(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return cl.List(ctx)
+}
+
+// sample names the first repositories as an example.
+func sample(repos []Repository) string {
+	names := make([]string, 0, 3)
+	for i := 0; i < len(repos) && i < 3; i++ {
+		names = append(names, repos[i].Name)
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	return ", e.g., " + strings.Join(names, ", ")
+}
+
+func (w *Wizard) provider() (Provider, error) {
+	for {
+		raw, err := w.ask("Provider (github, gitlab or gitea)", "github")
+		if err != nil {
+			return 0, err
+		}
+		provider, err := ParseProvider(raw)
+		if err == nil {
+			return provider, nil
+		}
+		_, _ = fmt.Fprintln(w.out, err)
+	}
+}
+
+func (w *Wizard) required(question string) (string, error) {
+	for {
+		answer, err := w.ask(question, "")
+		if err != nil || answer != "" {
+			return answer, err
+		}
+	}
+}
+
+func (w *Wizard) url(question string, fallback string) (string, error) {
+	for {
+		answer, err := w.ask(question, fallback)
+		if err != nil {
+			return "", err
+		}
+		u, err := url.Parse(answer)
+		if err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" {
+			return answer, nil
+		}
+		_, _ = fmt.Fprintf(w.out, "%q is not a valid http(s) URL\n", answer)
+	}
+}
+
+func (w *Wizard) confirm(question string, fallback bool) (bool, error) {
+	options := "y/N"
+	if fallback {
+		options = "Y/n"
+	}
+	for {
+		answer, err := w.ask(question+" ["+options+"]", "")
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(answer) {
+		case "":
+			return fallback, nil
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+	}
+}
+
+// ask prints the question with its fallback and returns the answer, or the fallback if the answer is empty.
+func (w *Wizard) ask(question string, fallback string) (string, error) {
+	if fallback != "" {
+		question = fmt.Sprintf("%s [%s]", question, fallback)
+	}
+	if !strings.HasSuffix(question, ": ") {
+		question += ": "
+	}
+	_, _ = fmt.Fprint(w.out, question)
+
+	line, err := w.in.ReadString('\n')
+	if err == io.EOF && line == "" {
+		return "", fmt.Errorf("no answer to %q", strings.TrimSuffix(question, ": "))
+	} else if err != nil && err != io.EOF {
+		return "", err
+	}
+
+	answer := strings.TrimSpace(line)
+	if answer == "" {
+		return fallback, nil
+	}
+	return answer, nil
+}
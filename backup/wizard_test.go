@@ -0,0 +1,101 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/d5/tengo/v2"
+)
+
+// fakeClient lists fixed repositories if its token is valid.
+type fakeClient struct {
+	account Account
+	repos   []Repository
+}
+
+func (c *fakeClient) Init(context.Context) error { return nil }
+
+func (c *fakeClient) List(context.Context) ([]Repository, error) {
+	if c.account.Token != "valid" {
+		return nil, fmt.Errorf("401 Bad credentials")
+	}
+	return c.repos, nil
+}
+
+func (c *fakeClient) Name() string { return c.account.Name }
+
+func (c *fakeClient) RegisterFilter([]*tengo.Script) {}
+
+func TestWizard(t *testing.T) {
+	root := path.Join(t.TempDir(), "backup")
+	answers := strings.Join([]string{
+		root,
+		"bitbucket", // unknown provider, asked again
+		"GitHub",
+		"me",
+		"", // suggested name
+		"wrong",
+		"",
+		"github",
+		"me",
+		"",
+		"valid",
+		"y",
+		"gitea",
+		"gitea.example.com", // not a URL, asked again
+		"https://gitea.example.com",
+		"github-me", // taken, asked again
+		"home",
+		"valid",
+		"",
+	}, "\n") + "\n"
+
+	var out strings.Builder
+	w := NewWizard(strings.NewReader(answers), &out)
+	w.client = func(account Account) client {
+		return &fakeClient{account: account, repos: []Repository{{Name: "me/a"}, {Name: "me/b"}}}
+	}
+
+	raw, err := w.Run(context.Background())
+	if err != nil {
+		t.Fatal(err, "\n", out.String())
+	}
+	for _, expected := range []string{
+		`unknown provider "bitbucket"`,
+		"Could not list the repositories of github-me: 401 Bad credentials",
+		`"gitea.example.com" is not a valid http(s) URL`,
+		`An account named "github-me" exists already.`,
+		"Found 2 repositories that would be backed up, e.g., me/a, me/b",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Fatal("expected the output to contain", expected, "got\n", out.String())
+		}
+	}
+
+	config, err := LoadConfig(raw)
+	if err != nil {
+		t.Fatal(err, "\n", string(raw))
+	}
+	if config.Repository != root || len(config.Accounts) != 2 {
+		t.Fatal("got", config)
+	}
+	github, gitea := config.Accounts[0], config.Accounts[1]
+	if github.Name != "github-me" || github.Provider != GitHub || github.Token != "valid" || github.Args[0] != "me" {
+		t.Fatal("got", github)
+	}
+	if gitea.Name != "home" || gitea.Provider != Gitea || gitea.Args[0] != "https://gitea.example.com" {
+		t.Fatal("got", gitea)
+	}
+	if !strings.Contains(string(raw), "# 2 repositories at the time of gitback init") {
+		t.Fatal("expected a commented config, got\n", string(raw))
+	}
+
+	_, err = NewWizard(strings.NewReader(root+"\n"), io.Discard).Run(context.Background())
+	if err == nil {
+		t.Fatal("expected missing answers to fail")
+	}
+}
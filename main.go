@@ -18,13 +18,18 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
 
 	"github.com/sirupsen/logrus"
 	lib "github.com/tawalaya/GoGitBackup/backup"
 	"github.com/urfave/cli/v2"
 	prefixed "github.com/x-cray/logrus-prefixed-formatter"
-	"gopkg.in/yaml.v2"
 )
 
 var (
@@ -70,15 +75,70 @@ func main() {
 			},
 		},
 		Commands: []*cli.Command{
+			{
+				Name:  "init",
+				Usage: "asks for the accounts to back up, checks their tokens and writes the config",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:    "force",
+						Aliases: []string{"f"},
+						Usage:   "Overwrites an existing config",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					file := c.String("config")
+					if ext := strings.ToLower(filepath.Ext(file)); ext == ".json" || ext == ".toml" {
+						return fmt.Errorf("init writes YAML configs, choose a file ending in .yml")
+					}
+					if _, err := os.Stat(file); err == nil && !c.Bool("force") {
+						return fmt.Errorf("config %s exists already, use --force to overwrite it", file)
+					}
+
+					config, err := lib.NewWizard(os.Stdin, os.Stdout).Run(c.Context)
+					if err != nil {
+						return err
+					}
+					err = os.WriteFile(file, config, 0600)
+					if err != nil {
+						return err
+					}
+					fmt.Printf("Wrote %s, run gitback check to see what is backed up\n", file)
+					return nil
+				},
+			},
+			{
+				Name:  "config",
+				Usage: "commands about the config file itself",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "schema",
+						Usage: "prints the JSON Schema of the config, for editors to complete and validate it",
+						Action: func(c *cli.Context) error {
+							schema, err := lib.Schema()
+							if err != nil {
+								return err
+							}
+							_, err = os.Stdout.Write(schema)
+							return err
+						},
+					},
+				},
+			},
 			{
 				Name:    "backup",
 				Aliases: []string{"b"},
 				Usage:   "performs backup of all git(hub/lab) accounts that can be accessed.",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:    "resume",
+						Aliases: []string{"r"},
+						Usage:   "Skips repositories already completed by an interrupted run",
+					},
+				},
 				Action: func(c *cli.Context) error {
 					client := preflight(c)
 					defer client.Close()
-					client.Do()
-					return nil
+					return client.Do(c.Context, c.Bool("resume"))
 				},
 			},
 			{
@@ -86,9 +146,170 @@ func main() {
 				Aliases: []string{"c"},
 				Usage:   "check what we can backup using this utility and also validates your config ;)",
 				Action: func(c *cli.Context) error {
+					// preflight validates the config before anything else
 					client := preflight(c)
 					defer client.Close()
-					return client.Check()
+					fmt.Printf("Config %s is valid\n", c.String("config"))
+					return client.Check(c.Context)
+				},
+			},
+			{
+				Name:    "archive",
+				Aliases: []string{"a"},
+				Usage:   "writes a git bundle of every backed up repository into a dated directory",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "output",
+						Aliases: []string{"o"},
+						Usage:   "Write the archives below `DIR` instead of the configured archive directory",
+					},
+					&cli.BoolFlag{
+						Name:    "incremental",
+						Aliases: []string{"i"},
+						Usage:   "Only bundles objects that are new since the previous archive",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					client := preflight(c)
+					defer client.Close()
+					target, err := client.Archive(c.Context, c.String("output"), c.Bool("incremental"))
+					if err == nil {
+						fmt.Printf("Archived into %s\n", target)
+					}
+					return err
+				},
+			},
+			{
+				Name:      "restore",
+				Aliases:   []string{"r"},
+				Usage:     "restores repositories from their archived bundles or pushes them to another account",
+				ArgsUsage: "[repository...]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "from",
+						Aliases: []string{"f"},
+						Usage:   "Read the archives below `DIR` instead of the configured archive directory",
+					},
+					&cli.StringFlag{
+						Name:  "into",
+						Usage: "Restore into `DIR` instead of the configured repository",
+					},
+					&cli.StringFlag{
+						Name:    "identity",
+						Aliases: []string{"i"},
+						Usage:   "Decrypt the archives with the age identity or OpenPGP private key in `FILE`",
+					},
+					&cli.StringFlag{
+						Name:    "push-to",
+						Aliases: []string{"p"},
+						Usage:   "Push the repositories to `ACCOUNT`, creating them if they are missing",
+					},
+					&cli.StringFlag{
+						Name:  "namespace",
+						Usage: "Create the pushed repositories below the group or organization `NS`",
+					},
+					&cli.StringFlag{
+						Name:  "name",
+						Usage: "Name the pushed repositories by the template `TMPL` with .Name, .Namespace and .Base, defaults to {{.Base}}",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					client := preflight(c)
+					defer client.Close()
+					// restoring over the backup fails for every repository that exists, the archives need their own directory
+					if c.String("push-to") != "" && c.String("from") != "" && c.String("into") == "" {
+						return fmt.Errorf("--push-to with --from requires --into")
+					}
+					// without --from, pushing works on the repositories that are already on disk
+					if c.String("push-to") == "" || c.String("from") != "" {
+						err := client.Restore(c.Context, c.String("from"), c.String("into"), c.String("identity"), c.Args().Slice())
+						if err != nil {
+							return err
+						}
+					}
+					if c.String("push-to") != "" {
+						return client.Push(c.Context, c.String("into"), c.Args().Slice(), c.String("push-to"), c.String("namespace"), c.String("name"))
+					}
+					return nil
+				},
+			},
+			{
+				Name:    "mirror",
+				Aliases: []string{"m"},
+				Usage:   "fetches the repositories of each mirror source and pushes them to its destination account",
+				Action: func(c *cli.Context) error {
+					client := preflight(c)
+					defer client.Close()
+					return client.Mirror(c.Context)
+				},
+			},
+			{
+				Name:    "snapshots",
+				Aliases: []string{"s"},
+				Usage:   "lists the snapshots recorded after each backup run",
+				Action: func(c *cli.Context) error {
+					client := preflight(c)
+					defer client.Close()
+					return client.ListSnapshots()
+				},
+				Subcommands: []*cli.Command{
+					{
+						Name:  "prune",
+						Usage: "removes all snapshots that are not kept by the retention policy",
+						Action: func(c *cli.Context) error {
+							client := preflight(c)
+							defer client.Close()
+							return client.PruneSnapshots()
+						},
+					},
+				},
+			},
+			{
+				Name:  "secrets",
+				Usage: "manages the tokens in the encrypted vault of the config",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "set",
+						Usage:     "stores a token read from the terminal or stdin under a name",
+						ArgsUsage: "NAME",
+						Action: func(c *cli.Context) error {
+							vault := vaultConfig(c)
+							if c.NArg() != 1 {
+								return fmt.Errorf("expected the name of the secret")
+							}
+							token, err := lib.PromptSecret("Token: ")
+							if err != nil {
+								return err
+							}
+							return lib.SetSecret(vault, c.Args().First(), token)
+						},
+					},
+					{
+						Name:  "list",
+						Usage: "lists the names of all stored tokens",
+						Action: func(c *cli.Context) error {
+							names, err := lib.ListSecrets(vaultConfig(c))
+							if err != nil {
+								return err
+							}
+							for _, name := range names {
+								fmt.Println(name)
+							}
+							return nil
+						},
+					},
+					{
+						Name:      "rm",
+						Usage:     "removes a stored token",
+						ArgsUsage: "NAME",
+						Action: func(c *cli.Context) error {
+							vault := vaultConfig(c)
+							if c.NArg() != 1 {
+								return fmt.Errorf("expected the name of the secret")
+							}
+							return lib.RemoveSecret(vault, c.Args().First())
+						},
+					},
 				},
 			},
 			{
@@ -98,13 +319,21 @@ func main() {
 				Action: func(c *cli.Context) error {
 					client := preflight(c)
 					defer client.Close()
-					return client.Update()
+					return client.Update(c.Context)
 				},
 			},
 		},
 	}
 
-	err := app.Run(os.Args)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		//restore the default behavior, a second signal terminates immediately
+		stop()
+	}()
+
+	err := app.RunContext(ctx, os.Args)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -113,18 +342,10 @@ func main() {
 
 func preflight(c *cli.Context) *lib.GoGitBackup {
 
-	bytes, err := os.ReadFile(c.String("config"))
+	config, err := lib.LoadConfigFile(c.String("config"))
 
 	if err != nil {
-		log.Fatalf("failed to read config at %s %+v", c.String("config"), err)
-	}
-
-	var config lib.Config
-
-	err = yaml.Unmarshal(bytes, &config)
-
-	if err != nil {
-		log.Fatalf("failed to parse config, %+v", err)
+		log.Fatalf("invalid config %s:\n%+v", c.String("config"), err)
 	}
 
 	if c.Bool("verbose") {
@@ -143,11 +364,11 @@ func preflight(c *cli.Context) *lib.GoGitBackup {
 	} else {
 		logfile, err = os.OpenFile("error.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 		if err != nil {
-			log.Error("failed to open error log file %e", err)
+			log.Errorf("failed to open error log file %+v", err)
 		}
 	}
 
-	client, err := lib.NewGoBackup(&config, logfile)
+	client, err := lib.NewGoBackup(config, logfile)
 
 	lib.SetLogger(logger)
 	lib.SetLog(log)
@@ -159,3 +380,12 @@ func preflight(c *cli.Context) *lib.GoGitBackup {
 	return client
 
 }
+
+// vaultConfig reads only the vault section of the config, the accounts may still refer to secrets that do not exist.
+func vaultConfig(c *cli.Context) *lib.Vault {
+	vault, err := lib.VaultConfig(c.String("config"))
+	if err != nil {
+		log.Fatalf("invalid config %s: %+v", c.String("config"), err)
+	}
+	return vault
+}